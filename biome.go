@@ -0,0 +1,256 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"errors"
+	"math"
+)
+
+// Biome describes the terrain of a region with a certain climate. Temperature and Humidity are
+// the climate the biome is placed at, both in the range [0, 1]. Columns get the biome with the
+// closest climate, heights of neighboring biomes are blended.
+type Biome struct {
+	Name        string
+	Temperature float64
+	Humidity    float64
+
+	// block type ids of the top most block and of the blocks below it
+	Surface uint16
+	Filler  uint16
+
+	// terrain height in blocks is BaseHeight + HeightScale*noise, where noise is in [0, 1]
+	BaseHeight  float64
+	HeightScale float64
+
+	// parameters of SimplexNoise.Simplex2. Scale is the noise frequency per block.
+	Octaves     int
+	Persistence float64
+	Lacunarity  float64
+	Scale       float64
+}
+
+// defaultBiome is used if no biome is registered. It reproduces the original terrain.
+var defaultBiome = &Biome{
+	Name:        "default",
+	Surface:     1,
+	Filler:      1,
+	HeightScale: ChunkHeight,
+	Octaves:     3,
+	Persistence: 0.5,
+	Lacunarity:  2,
+	Scale:       1.0 / ChunkWidth,
+}
+
+// height returns the terrain height of the biome at the given world column
+func (b *Biome) height(noise *SimplexNoise, x, z float64) float64 {
+	n := noise.Simplex2(x*b.Scale, z*b.Scale, b.Octaves, b.Persistence, b.Lacunarity)
+	return b.BaseHeight + n*b.HeightScale
+}
+
+// ----------------------------------------------------------------------------
+var (
+	errBiomeName      = errors.New("vox: biome has no name")
+	errBiomeDuplicate = errors.New("vox: biome already registered")
+	errBiomeOctaves   = errors.New("vox: biome needs at least one octave")
+)
+
+// BiomeRegistry holds the biomes of a generator. Biomes must be registered before the world
+// starts generating chunks.
+type BiomeRegistry struct {
+	biomes []*Biome
+	names  map[string]*Biome
+}
+
+func NewBiomeRegistry() *BiomeRegistry {
+	return &BiomeRegistry{
+		names: make(map[string]*Biome),
+	}
+}
+
+// Register adds a biome. Names must be unique.
+func (r *BiomeRegistry) Register(biome *Biome) error {
+	if biome.Name == "" {
+		return errBiomeName
+	}
+	if biome.Octaves < 1 {
+		return errBiomeOctaves
+	}
+	if _, ok := r.names[biome.Name]; ok {
+		return errBiomeDuplicate
+	}
+	r.names[biome.Name] = biome
+	r.biomes = append(r.biomes, biome)
+	return nil
+}
+
+// Get returns the biome with the given name or nil
+func (r *BiomeRegistry) Get(name string) *Biome {
+	return r.names[name]
+}
+
+// All returns the registered biomes in registration order
+func (r *BiomeRegistry) All() []*Biome {
+	return r.biomes
+}
+
+func (r *BiomeRegistry) Len() int {
+	return len(r.biomes)
+}
+
+// ----------------------------------------------------------------------------
+
+// column is the result of the biome lookup for a single world column
+type column struct {
+	biome  *Biome
+	height int
+}
+
+// climatePoint is the climate at a world column & how fast it changes per block along x & z
+type climatePoint struct {
+	temperature, humidity float64
+	temperatureGradient   [2]float64
+	humidityGradient      [2]float64
+}
+
+// blendColumn finds the dominant biome at the climate & blends the heights of the biomes, that
+// are less than width blocks away. The distance to the border of a biome is estimated from the
+// climate gradient, so the transitions have the same width in blocks, no matter how fast the
+// climate changes. Everything only depends on world coordinates, so there are no seams at chunk
+// borders.
+func blendColumn(biomes []*Biome, noise *SimplexNoise, x, z float64, c *climatePoint, width float64) column {
+	if len(biomes) == 0 {
+		return column{defaultBiome, int(defaultBiome.height(noise, x, z))}
+	}
+
+	var best *Biome
+	var bestDist = math.MaxFloat64
+	for _, b := range biomes {
+		if dist := climateDist(b, c); dist < bestDist {
+			best, bestDist = b, dist
+		}
+	}
+
+	var height, total float64
+	for _, b := range biomes {
+		weight := 1.0
+		if b != best {
+			// the climate distance margin to the dominant biome & its gradient per block
+			margin := climateDist(b, c) - bestDist
+			dt, dh := climateSlope(b, c)
+			bt, bh := climateSlope(best, c)
+			gx := (dt-bt)*c.temperatureGradient[0] + (dh-bh)*c.humidityGradient[0]
+			gz := (dt-bt)*c.temperatureGradient[1] + (dh-bh)*c.humidityGradient[1]
+			slope := math.Sqrt(gx*gx + gz*gz)
+			if slope == 0 {
+				continue
+			}
+
+			// smooth step from 1 at the border to 0 at width blocks away from it
+			w := 1 - margin/slope/width
+			if w <= 0 {
+				continue
+			}
+			weight = w * w * (3 - 2*w)
+		}
+		height += b.height(noise, x, z) * weight
+		total += weight
+	}
+
+	return column{best, int(math.Floor(height / total))}
+}
+
+// climateDist returns the distance of the biome to the climate in climate space
+func climateDist(b *Biome, c *climatePoint) float64 {
+	dt := c.temperature - b.Temperature
+	dh := c.humidity - b.Humidity
+	return math.Sqrt(dt*dt + dh*dh)
+}
+
+// climateSlope returns the derivatives of climateDist by temperature & humidity
+func climateSlope(b *Biome, c *climatePoint) (float64, float64) {
+	dist := climateDist(b, c)
+	if dist == 0 {
+		return 0, 0
+	}
+	return (c.temperature - b.Temperature) / dist, (c.humidity - b.Humidity) / dist
+}
+
+// ----------------------------------------------------------------------------
+
+// Terrain computes the biome & terrain height of world columns. Temperature & humidity are
+// low frequency noise fields, the biomes are picked by the climate at a column.
+type Terrain struct {
+	Biomes *BiomeRegistry
+
+	// ClimateScale is the frequency of the temperature & humidity noise per block
+	ClimateScale float64
+	// ClimateOctaves is the number of octaves of the temperature & humidity noise
+	ClimateOctaves int
+	// BlendWidth is the distance in blocks from a biome border, over which the heights of
+	// the biomes are blended
+	BlendWidth float64
+
+	noise       *SimplexNoise
+	temperature *SimplexNoise
+	humidity    *SimplexNoise
+}
+
+func NewTerrain(seed int64) *Terrain {
+	return &Terrain{
+		Biomes:         NewBiomeRegistry(),
+		ClimateScale:   1.0 / 512,
+		ClimateOctaves: 2,
+		BlendWidth:     16,
+		noise:          NewSimplex(seed),
+		temperature:    NewSimplex(int64(HashCoords(seed, 1, 0, 0))),
+		humidity:       NewSimplex(int64(HashCoords(seed, 2, 0, 0))),
+	}
+}
+
+// BiomeAt returns the dominant biome at the given world column
+func (t *Terrain) BiomeAt(x, z int) *Biome {
+	return t.columnAt(x, z).biome
+}
+
+// HeightAt returns the world y of the first air block above the terrain at the given column
+func (t *Terrain) HeightAt(x, z int) int {
+	return t.columnAt(x, z).height
+}
+
+func (t *Terrain) columnAt(x, z int) column {
+	fx, fz := float64(x), float64(z)
+	c := &climatePoint{}
+	c.temperature, c.humidity = t.climateAt(fx, fz)
+
+	// the climate of the next columns along x & z
+	tx, hx := t.climateAt(fx+1, fz)
+	tz, hz := t.climateAt(fx, fz+1)
+	c.temperatureGradient = [2]float64{tx - c.temperature, tz - c.temperature}
+	c.humidityGradient = [2]float64{hx - c.humidity, hz - c.humidity}
+
+	return blendColumn(t.Biomes.All(), t.noise, fx, fz, c, t.BlendWidth)
+}
+
+// climateAt returns the temperature & humidity at the given world column
+func (t *Terrain) climateAt(x, z float64) (float64, float64) {
+	temperature := climate(t.temperature.Simplex2(x*t.ClimateScale, z*t.ClimateScale, t.ClimateOctaves, 0.5, 2))
+	humidity := climate(t.humidity.Simplex2(x*t.ClimateScale, z*t.ClimateScale, t.ClimateOctaves, 0.5, 2))
+	return temperature, humidity
+}
+
+// climate stretches the noise, which is mostly close to 0.5, to the full range
+func climate(n float64) float64 {
+	return math.Max(0, math.Min(1, 0.5+(n-0.5)*2))
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"math"
+	"testing"
+)
+
+func newTestBiomes() []*Biome {
+	return []*Biome{
+		&Biome{Name: "low", Temperature: 0.2, Humidity: 0.5, Surface: 2, Filler: 1,
+			BaseHeight: 2, HeightScale: 8, Octaves: 2, Persistence: 0.5, Lacunarity: 2, Scale: 1.0 / 32},
+		&Biome{Name: "high", Temperature: 0.8, Humidity: 0.5, Surface: 3, Filler: 3,
+			BaseHeight: 16, HeightScale: 24, Octaves: 3, Persistence: 0.5, Lacunarity: 2, Scale: 1.0 / 32},
+	}
+}
+
+func newBiomeGenerator() *SimplexGenerator {
+	gen := NewSimplexGenerator(16726)
+	gen.ClimateScale = 1.0 / 64
+	for _, b := range newTestBiomes() {
+		gen.Biomes.Register(b)
+	}
+	return gen
+}
+
+// surfaceHeight returns the world y above the highest active block of a column
+func surfaceHeight(chunks []*Chunk, x, z int) int {
+	for i := len(chunks) - 1; i >= 0; i-- {
+		for y := ChunkHeight - 1; y >= 0; y-- {
+			if chunks[i].Get(x, y, z).Active() {
+				return chunks[i].Position.Y*ChunkHeight + y + 1
+			}
+		}
+	}
+	return math.MinInt32
+}
+
+func TestBiomeRegistry(t *testing.T) {
+	r := NewBiomeRegistry()
+	for _, b := range newTestBiomes() {
+		if err := r.Register(b); err != nil {
+			t.Error(err)
+		}
+	}
+	if r.Len() != 2 || r.Get("high") != r.All()[1] || r.Get("none") != nil {
+		t.Error()
+	}
+	if r.Register(&Biome{Name: "low", Octaves: 1}) != errBiomeDuplicate {
+		t.Error()
+	}
+	if r.Register(&Biome{Octaves: 1}) != errBiomeName {
+		t.Error()
+	}
+	if r.Register(&Biome{Name: "flat"}) != errBiomeOctaves {
+		t.Error()
+	}
+}
+
+func TestBiomeSurface(t *testing.T) {
+	gen := newBiomeGenerator()
+	bank := newTestBank()
+
+	found := make(map[string]bool)
+	for cx := -8; cx < 8; cx++ {
+		for cz := -8; cz < 8; cz++ {
+			chunks := make([]*Chunk, 0)
+			for cy := 0; cy < 3; cy++ {
+				chunks = append(chunks, gen.GenerateChunkAt(cx, cy, cz, bank))
+			}
+			x, z := 7, 7
+			biome := gen.BiomeAt(cx*ChunkWidth+x, cz*ChunkDepth+z)
+			found[biome.Name] = true
+
+			h := surfaceHeight(chunks, x, z)
+			if h <= 0 {
+				continue
+			}
+			top := chunks[FloorDiv(h-1, ChunkHeight)].Get(x, (h-1)-FloorDiv(h-1, ChunkHeight)*ChunkHeight, z)
+			if top.TypeID() != biome.Surface {
+				t.Errorf("surface at %v,%v is %v, want %v", cx, cz, top.TypeID(), biome.Surface)
+			}
+		}
+	}
+	if !found["low"] || !found["high"] {
+		t.Errorf("not all biomes generated: %v", found)
+	}
+}
+
+func TestBiomeBorders(t *testing.T) {
+	// neighboring columns must never jump, not even across biome borders
+	for _, seed := range []int64{16726, 1, 99} {
+		gen := NewTerrain(seed)
+		for _, b := range newTestBiomes() {
+			gen.Biomes.Register(b)
+		}
+
+		maxStep, borders := 0, 0
+		for _, z := range []int{-1500, 0, 700} {
+			prev, prevBiome := gen.HeightAt(-2000, z), gen.BiomeAt(-2000, z)
+			for x := -1999; x < 2000; x++ {
+				h, biome := gen.HeightAt(x, z), gen.BiomeAt(x, z)
+				if biome != prevBiome {
+					borders++
+				}
+				for _, step := range []int{h - prev, gen.HeightAt(x, z+1) - h} {
+					if step < 0 {
+						step = -step
+					}
+					if step > maxStep {
+						maxStep = step
+					}
+				}
+				prev, prevBiome = h, biome
+			}
+		}
+		if maxStep > 3 || borders < 10 {
+			t.Errorf("seed %v: height step of %v blocks at %v borders", seed, maxStep, borders)
+		}
+	}
+}
+
+func TestBiomeGeneratorDeterministic(t *testing.T) {
+	checkDeterministic(t, func() Generator { return newBiomeGenerator() })
+}
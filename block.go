@@ -13,12 +13,16 @@
 
 package vox
 
-type Block uint8
+// Block is the state of a single block. The lower 15 bits are the id of the BlockType,
+// bit 15 tells if the block is active. The upper 16 bits hold the values of the properties
+// of the block type, see Property.
+type Block uint32
 
 const (
 	BlockNil        = 0x00
-	blockActiveMask = 0x80 // 0b10000000
-	blockTypeMask   = 0x7F // 0b01111111
+	blockActiveMask = 0x8000 // 0b1000000000000000
+	blockTypeMask   = 0x7FFF // 0b0111111111111111
+	blockStateShift = 16
 )
 
 func (b Block) Active() bool {
@@ -29,32 +33,80 @@ func (b Block) Activate(active bool) Block {
 	if active {
 		return b | blockActiveMask
 	}
-	return b & blockTypeMask
+	return b &^ blockActiveMask
 }
 
-func (b Block) TypeID() uint8 {
-	return uint8(b & blockTypeMask)
+func (b Block) TypeID() uint16 {
+	return uint16(b & blockTypeMask)
 }
 
+// ChangeType changes the type of the block. The state is reset, because the properties belong
+// to the old type.
 func (b Block) ChangeType(t *BlockType) Block {
-	return Block((uint8(b) & blockActiveMask) | t.ID)
+	return (b & blockActiveMask) | Block(t.ID)
 }
 
+// State returns the packed property values of the block.
+func (b Block) State() uint16 {
+	return uint16(b >> blockStateShift)
+}
+
+// WithState replaces the packed property values of the block.
+func (b Block) WithState(state uint16) Block {
+	return Block(uint16(b)) | Block(state)<<blockStateShift
+}
+
+// RenderLayer tells how the faces of a block type are drawn.
+type RenderLayer uint8
+
+const (
+	// LayerOpaque blocks hide everything behind them. This is the default.
+	LayerOpaque RenderLayer = iota
+	// LayerCutout blocks, like leaves, are either fully opaque or fully transparent per pixel.
+	// Transparent pixels are discarded by the alpha test.
+	LayerCutout
+	// LayerTranslucent blocks, like glass, water or ice, are blended with whatever is behind them.
+	LayerTranslucent
+
+	renderLayerCount = 3
+)
+
 type BlockType struct {
-	ID     uint8
+	ID uint16
+
+	// Layer is the render pass of the block type. Faces between two blocks of the same
+	// non-opaque type are hidden, so the inside of a glass wall is not drawn.
+	Layer RenderLayer
+
+	// Model is the shape of the blocks. nil is a unit cube.
+	Model *BlockModel
+	// Light is the light level (0 - MaxLight), that the blocks emit.
+	Light uint8
+
+	// Faces are the textures of the six faces, indexed by FaceLeft..FaceFront. A nil face
+	// falls back to Top, Bottom or Side, so most types only need the three shorthand slots.
+	Faces  [6]*TextureRegion
 	Top    *TextureRegion
 	Bottom *TextureRegion
 	Side   *TextureRegion
+
+	// Properties are the state properties of the type. Use AddProperty to add them.
+	Properties []*Property
+	stateBits  uint
+
+	// the properties, that rotate the block model. See orientedFaces.
+	facing *Property
+	axis   *Property
 }
 
 type BlockBank struct {
 	Types   []*BlockType
-	typeMap map[uint8]*BlockType
+	typeMap map[uint16]*BlockType
 }
 
 func NewBlockBank() *BlockBank {
 	return &BlockBank{
-		typeMap: make(map[uint8]*BlockType),
+		typeMap: make(map[uint16]*BlockType),
 	}
 }
 
@@ -66,3 +118,17 @@ func (b *BlockBank) AddType(blockType *BlockType) {
 func (b *BlockBank) TypeOf(block Block) *BlockType {
 	return b.typeMap[block.TypeID()]
 }
+
+// faceRegion returns the texture region of the given face of the unrotated block.
+func (t *BlockType) faceRegion(face int) *TextureRegion {
+	if t.Faces[face] != nil {
+		return t.Faces[face]
+	}
+	switch face {
+	case FaceTop:
+		return t.Top
+	case FaceBottom:
+		return t.Bottom
+	}
+	return t.Side
+}
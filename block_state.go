@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"errors"
+	"fmt"
+)
+
+// blockStateBits is the number of bits for the property values of a block
+const blockStateBits = 16
+
+var errStateFull = errors.New("vox: the properties of the block type need more than 16 bits")
+
+// Property is a state property of a block type, like the facing of a log or the water level.
+// The index of the value is packed into the state bits of a Block, using only as many bits as
+// needed for the number of values. A property belongs to exactly one block type.
+type Property struct {
+	Name   string
+	Values []string
+
+	offset uint
+	bits   uint
+	owner  *BlockType
+}
+
+func NewProperty(name string, values ...string) *Property {
+	return &Property{Name: name, Values: values, bits: paletteBits(len(values))}
+}
+
+// Index returns the index of the value of the property.
+func (p *Property) Index(b Block) int {
+	return int(b.State()>>p.offset) & (1<<p.bits - 1)
+}
+
+// WithIndex returns the block with the property set to the value at the given index.
+func (p *Property) WithIndex(b Block, index int) Block {
+	mask := uint16(1<<p.bits-1) << p.offset
+	state := b.State()&^mask | uint16(index)<<p.offset&mask
+	return b.WithState(state)
+}
+
+// Value returns the name of the value of the property.
+func (p *Property) Value(b Block) string {
+	index := p.Index(b)
+	if index >= len(p.Values) {
+		return ""
+	}
+	return p.Values[index]
+}
+
+// WithValue returns the block with the property set to the given value. Returns false if the
+// property has no such value.
+func (p *Property) WithValue(b Block, value string) (Block, bool) {
+	for i, v := range p.Values {
+		if v == value {
+			return p.WithIndex(b, i), true
+		}
+	}
+	return b, false
+}
+
+// AddProperty adds the property to the block type & assigns its bits in the block state.
+func (t *BlockType) AddProperty(p *Property) error {
+	if p.owner != nil {
+		return fmt.Errorf("vox: property %q already belongs to block type %v", p.Name, p.owner.ID)
+	}
+	if t.Property(p.Name) != nil {
+		return fmt.Errorf("vox: block type %v already has a property %q", t.ID, p.Name)
+	}
+	if t.stateBits+p.bits > blockStateBits {
+		return errStateFull
+	}
+	p.offset = t.stateBits
+	p.owner = t
+	t.stateBits += p.bits
+	t.Properties = append(t.Properties, p)
+
+	// a "facing" or "axis" property with the values of the typed properties rotates the block
+	switch {
+	case p.Name == "facing" && len(p.Values) == len(facingNames):
+		t.facing = p
+	case p.Name == "axis" && len(p.Values) == len(axisNames):
+		t.axis = p
+	}
+	return nil
+}
+
+// Property returns the property with the given name or nil.
+func (t *BlockType) Property(name string) *Property {
+	for _, p := range t.Properties {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Facing is the direction a block faces.
+type Facing uint8
+
+const (
+	FacingNorth Facing = iota
+	FacingEast
+	FacingSouth
+	FacingWest
+	FacingUp
+	FacingDown
+)
+
+var facingNames = []string{"north", "east", "south", "west", "up", "down"}
+
+func (f Facing) String() string {
+	return facingNames[f]
+}
+
+// FacingProperty stores one of the six directions.
+type FacingProperty struct {
+	*Property
+}
+
+func NewFacingProperty() *FacingProperty {
+	return &FacingProperty{NewProperty("facing", facingNames...)}
+}
+
+func (p *FacingProperty) Get(b Block) Facing {
+	return Facing(p.Index(b))
+}
+
+func (p *FacingProperty) Set(b Block, f Facing) Block {
+	return p.WithIndex(b, int(f))
+}
+
+// Axis is the axis along which a block, like a log, is aligned.
+type Axis uint8
+
+const (
+	AxisY Axis = iota
+	AxisX
+	AxisZ
+)
+
+var axisNames = []string{"y", "x", "z"}
+
+func (a Axis) String() string {
+	return axisNames[a]
+}
+
+// AxisProperty stores one of the three axes. The default is AxisY.
+type AxisProperty struct {
+	*Property
+}
+
+func NewAxisProperty() *AxisProperty {
+	return &AxisProperty{NewProperty("axis", axisNames...)}
+}
+
+func (p *AxisProperty) Get(b Block) Axis {
+	return Axis(p.Index(b))
+}
+
+func (p *AxisProperty) Set(b Block, a Axis) Block {
+	return p.WithIndex(b, int(a))
+}
+
+// Half is the half of the block, that a slab or a stair occupies.
+type Half uint8
+
+const (
+	HalfBottom Half = iota
+	HalfTop
+)
+
+// HalfProperty stores the top or the bottom half. The default is HalfBottom.
+type HalfProperty struct {
+	*Property
+}
+
+func NewHalfProperty() *HalfProperty {
+	return &HalfProperty{NewProperty("half", "bottom", "top")}
+}
+
+func (p *HalfProperty) Get(b Block) Half {
+	return Half(p.Index(b))
+}
+
+func (p *HalfProperty) Set(b Block, h Half) Block {
+	return p.WithIndex(b, int(h))
+}
+
+// LevelProperty stores a number from 0 to max, like a water level or a growth stage.
+type LevelProperty struct {
+	*Property
+}
+
+func NewLevelProperty(name string, max int) *LevelProperty {
+	values := make([]string, max+1)
+	for i := range values {
+		values[i] = fmt.Sprint(i)
+	}
+	return &LevelProperty{NewProperty(name, values...)}
+}
+
+func (p *LevelProperty) Get(b Block) int {
+	return p.Index(b)
+}
+
+// Set clamps the level to the range of the property.
+func (p *LevelProperty) Set(b Block, level int) Block {
+	return p.WithIndex(b, clampInt(level, 0, len(p.Values)-1))
+}
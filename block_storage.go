@@ -0,0 +1,259 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errCorruptStorage = errors.New("corrupt block storage data")
+
+// PaletteStorage stores the blocks of a chunk as indices into a palette of all distinct blocks
+// of the chunk. The indices are bit-packed into 64 bit words and use only as many bits as needed
+// to address the palette. A chunk that consists of a single kind of block doesn't need any index
+// data at all.
+//
+// The zero value is a storage where every block is BlockNil.
+type PaletteStorage struct {
+	palette []Block
+	// number of blocks referencing the palette entry. Entries with a count of 0 are free.
+	counts []uint16
+	bits   uint
+	data   []uint64
+}
+
+// Get returns the block at index i.
+func (s *PaletteStorage) Get(i int) Block {
+	if s.bits == 0 {
+		if len(s.palette) == 0 {
+			return BlockNil
+		}
+		return s.palette[0]
+	}
+	return s.palette[s.index(i)]
+}
+
+// Set sets the block at index i. The index width grows if the palette doesn't fit anymore and
+// shrinks again if palette entries become unused.
+func (s *PaletteStorage) Set(i int, block Block) {
+	if len(s.palette) == 0 {
+		if block == BlockNil {
+			return
+		}
+		s.palette = []Block{BlockNil}
+		s.counts = []uint16{ChunkXYZ}
+	}
+
+	old := 0
+	if s.bits > 0 {
+		old = s.index(i)
+	}
+	if s.palette[old] == block {
+		return
+	}
+
+	idx := s.lookup(block)
+	if idx < 0 {
+		idx = s.add(block)
+	}
+	s.counts[old]--
+	s.counts[idx]++
+	s.setIndex(i, idx)
+
+	if s.counts[old] == 0 {
+		s.shrink()
+	}
+}
+
+// PaletteSize returns the number of distinct blocks in the storage.
+func (s *PaletteStorage) PaletteSize() int {
+	size := 0
+	for _, count := range s.counts {
+		if count > 0 {
+			size++
+		}
+	}
+	return size
+}
+
+// BitsPerBlock returns the number of bits used to store a single block.
+func (s *PaletteStorage) BitsPerBlock() int {
+	return int(s.bits)
+}
+
+// MemoryUsage returns the approximate number of bytes used by the storage.
+func (s *PaletteStorage) MemoryUsage() int {
+	return len(s.palette)*4 + len(s.counts)*2 + len(s.data)*8
+}
+
+func (s *PaletteStorage) index(i int) int {
+	perWord := 64 / s.bits
+	shift := uint(i) % perWord * s.bits
+	return int(s.data[uint(i)/perWord] >> shift & (1<<s.bits - 1))
+}
+
+func (s *PaletteStorage) setIndex(i, idx int) {
+	perWord := 64 / s.bits
+	shift := uint(i) % perWord * s.bits
+	word := &s.data[uint(i)/perWord]
+	*word = *word&^((1<<s.bits-1)<<shift) | uint64(idx)<<shift
+}
+
+func (s *PaletteStorage) lookup(block Block) int {
+	for i, b := range s.palette {
+		if b == block && s.counts[i] > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// add puts the block into a free palette entry or appends a new one.
+func (s *PaletteStorage) add(block Block) int {
+	for i, count := range s.counts {
+		if count == 0 {
+			s.palette[i] = block
+			return i
+		}
+	}
+
+	s.palette = append(s.palette, block)
+	s.counts = append(s.counts, 0)
+	if len(s.palette) > 1<<s.bits {
+		s.repack(paletteBits(len(s.palette)), nil)
+	}
+	return len(s.palette) - 1
+}
+
+// shrink removes all unused palette entries, if the remaining ones fit into fewer bits.
+func (s *PaletteStorage) shrink() {
+	used := s.PaletteSize()
+	bits := paletteBits(used)
+	if bits >= s.bits {
+		return
+	}
+
+	remap := make([]int, len(s.palette))
+	palette := make([]Block, 0, used)
+	counts := make([]uint16, 0, used)
+	for i, count := range s.counts {
+		if count > 0 {
+			remap[i] = len(palette)
+			palette = append(palette, s.palette[i])
+			counts = append(counts, count)
+		}
+	}
+
+	s.repack(bits, remap)
+	s.palette = palette
+	s.counts = counts
+}
+
+// repack changes the number of bits per index. If remap is not nil all indices are mapped
+// to their new palette position.
+func (s *PaletteStorage) repack(bits uint, remap []int) {
+	if bits == 0 {
+		s.bits = 0
+		s.data = nil
+		return
+	}
+
+	perWord := int(64 / bits)
+	packed := PaletteStorage{bits: bits, data: make([]uint64, (ChunkXYZ+perWord-1)/perWord)}
+	if s.bits > 0 {
+		for i := 0; i < ChunkXYZ; i++ {
+			idx := s.index(i)
+			if remap != nil {
+				idx = remap[idx]
+			}
+			packed.setIndex(i, idx)
+		}
+	}
+
+	s.bits = packed.bits
+	s.data = packed.data
+}
+
+// paletteBits returns the number of bits needed to address a palette of the given size.
+func paletteBits(size int) uint {
+	var bits uint
+	for 1<<bits < size {
+		bits++
+	}
+	return bits
+}
+
+// MarshalBinary encodes the palette & the packed indices. Unused palette entries are kept, so
+// the indices don't need to be remapped.
+func (s *PaletteStorage) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, uint16(len(s.palette)))
+	binary.Write(buf, binary.LittleEndian, s.palette)
+	buf.WriteByte(byte(s.bits))
+	binary.Write(buf, binary.LittleEndian, s.data)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes data encoded by MarshalBinary. Returns an error if the data is corrupt.
+func (s *PaletteStorage) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var size uint16
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return errCorruptStorage
+	}
+	palette := make([]Block, size)
+	if err := binary.Read(r, binary.LittleEndian, palette); err != nil {
+		return errCorruptStorage
+	}
+	// the index width always matches the palette, an empty palette has no indices at all
+	bits, err := r.ReadByte()
+	if err != nil || uint(bits) != paletteBits(int(size)) {
+		return errCorruptStorage
+	}
+
+	decoded := PaletteStorage{palette: palette, bits: uint(bits)}
+	if bits > 0 {
+		perWord := 64 / int(bits)
+		decoded.data = make([]uint64, (ChunkXYZ+perWord-1)/perWord)
+		if err := binary.Read(r, binary.LittleEndian, decoded.data); err != nil {
+			return errCorruptStorage
+		}
+	}
+	if r.Len() != 0 {
+		return errCorruptStorage
+	}
+	if size == 0 {
+		*s = decoded
+		return nil
+	}
+
+	// count the palette references again
+	decoded.counts = make([]uint16, size)
+	for i := 0; i < ChunkXYZ; i++ {
+		idx := 0
+		if bits > 0 {
+			idx = decoded.index(i)
+		}
+		if idx >= int(size) {
+			return errCorruptStorage
+		}
+		decoded.counts[idx]++
+	}
+
+	*s = decoded
+	return nil
+}
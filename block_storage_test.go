@@ -0,0 +1,180 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// arrayStorage is the plain array chunks used before the palette storage. Used as
+// reference in tests & benchmarks.
+type arrayStorage [ChunkXYZ]Block
+
+func (s *arrayStorage) Get(i int) Block {
+	return s[i]
+}
+
+func (s *arrayStorage) Set(i int, block Block) {
+	s[i] = block
+}
+
+func TestPaletteStorageZeroValue(t *testing.T) {
+	var s PaletteStorage
+	for i := 0; i < ChunkXYZ; i++ {
+		if s.Get(i) != BlockNil {
+			t.Fatal()
+		}
+	}
+	s.Set(10, BlockNil)
+	if s.MemoryUsage() != 0 || s.BitsPerBlock() != 0 {
+		t.Error()
+	}
+}
+
+func TestPaletteStorageRandom(t *testing.T) {
+	var s PaletteStorage
+	var ref arrayStorage
+	rnd := rand.New(rand.NewSource(7))
+
+	for round, types := range []int{2, 5, 40, 300, 3, 1} {
+		for n := 0; n < 4*ChunkXYZ; n++ {
+			i := rnd.Intn(ChunkXYZ)
+			block := Block(rnd.Intn(types)).Activate(true)
+			s.Set(i, block)
+			ref.Set(i, block)
+		}
+		for i := 0; i < ChunkXYZ; i++ {
+			if s.Get(i) != ref.Get(i) {
+				t.Fatalf("round %v: block %v is %v, expected %v", round, i, s.Get(i), ref.Get(i))
+			}
+		}
+	}
+}
+
+func TestPaletteStorageGrowAndShrink(t *testing.T) {
+	var s PaletteStorage
+	stone := Block(1).Activate(true)
+
+	// uniform storage needs no index data
+	for i := 0; i < ChunkXYZ; i++ {
+		s.Set(i, stone)
+	}
+	if s.BitsPerBlock() != 0 || s.PaletteSize() != 1 || s.Get(100) != stone {
+		t.Error(s.BitsPerBlock(), s.PaletteSize())
+	}
+
+	// 17 distinct blocks need 5 bits
+	for i := 0; i < 16; i++ {
+		s.Set(i, Block(100+i))
+	}
+	if s.BitsPerBlock() != 5 || s.PaletteSize() != 17 {
+		t.Error(s.BitsPerBlock(), s.PaletteSize())
+	}
+
+	// back to 2 distinct blocks
+	for i := 1; i < 16; i++ {
+		s.Set(i, stone)
+	}
+	if s.BitsPerBlock() != 1 || s.PaletteSize() != 2 || s.Get(0) != Block(100) || s.Get(1) != stone {
+		t.Error(s.BitsPerBlock(), s.PaletteSize())
+	}
+
+	// and uniform again
+	s.Set(0, stone)
+	if s.BitsPerBlock() != 0 || s.Get(0) != stone || s.Get(ChunkXYZ-1) != stone {
+		t.Error(s.BitsPerBlock())
+	}
+}
+
+func TestPaletteStorageCorruption(t *testing.T) {
+	var s PaletteStorage
+	s.Set(3, Block(7))
+	s.Set(9, Block(8))
+	valid, _ := s.MarshalBinary()
+
+	// an empty palette with indices, trailing bytes & index widths that don't fit the palette
+	invalid := [][]byte{
+		{0, 0, 5},
+		{0, 0, 0, 1},
+		append(append([]byte{}, valid...), 0),
+		valid[:len(valid)-1],
+		{1, 0, 7, 0, 0, 0, 1},
+	}
+	wide := append([]byte{}, valid...)
+	wide[2+3*4] = 4
+	invalid = append(invalid, wide)
+
+	for i, data := range invalid {
+		var decoded PaletteStorage
+		if err := decoded.UnmarshalBinary(data); err == nil {
+			t.Error(i, decoded.BitsPerBlock())
+		}
+	}
+
+	var empty PaletteStorage
+	if err := empty.UnmarshalBinary([]byte{0, 0, 0}); err != nil || empty.Get(0) != BlockNil {
+		t.Error(err)
+	}
+}
+
+func TestPaletteStorageMemory(t *testing.T) {
+	bank := newTestBank()
+	chunk := NewSimplexGenerator(16726).GenerateChunkAt(3, 0, -2, bank)
+
+	array := ChunkXYZ * 4
+	if chunk.blocks.MemoryUsage() > array/4 {
+		t.Errorf("palette storage uses %v bytes, array %v bytes", chunk.blocks.MemoryUsage(), array)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+type blockStorage interface {
+	Get(i int) Block
+	Set(i int, block Block)
+}
+
+func fillStorage(s blockStorage, types int) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < ChunkXYZ; i++ {
+		s.Set(i, Block(rnd.Intn(types)).Activate(true))
+	}
+}
+
+func benchmarkGet(b *testing.B, s blockStorage, types int) {
+	fillStorage(s, types)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < ChunkXYZ; i++ {
+			s.Get(i)
+		}
+	}
+}
+
+func benchmarkSet(b *testing.B, s blockStorage, types int) {
+	fillStorage(s, types)
+	rnd := rand.New(rand.NewSource(2))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s.Set(rnd.Intn(ChunkXYZ), Block(rnd.Intn(types)).Activate(true))
+	}
+}
+
+func BenchmarkArrayStorageGet(b *testing.B)          { benchmarkGet(b, &arrayStorage{}, 4) }
+func BenchmarkPaletteStorageGet(b *testing.B)        { benchmarkGet(b, &PaletteStorage{}, 4) }
+func BenchmarkPaletteStorageGetUniform(b *testing.B) { benchmarkGet(b, &PaletteStorage{}, 1) }
+func BenchmarkArrayStorageSet(b *testing.B)          { benchmarkSet(b, &arrayStorage{}, 4) }
+func BenchmarkPaletteStorageSet(b *testing.B)        { benchmarkSet(b, &PaletteStorage{}, 4) }
+func BenchmarkPaletteStorageSetMany(b *testing.B)    { benchmarkSet(b, &PaletteStorage{}, 200) }
@@ -74,3 +74,97 @@ func TestBlockType(t *testing.T) {
 	}
 
 }
+
+func TestBlockProperties(t *testing.T) {
+	log := &BlockType{ID: 5}
+	axis := NewAxisProperty()
+	facing := NewFacingProperty()
+	level := NewLevelProperty("level", 7)
+	half := NewHalfProperty()
+	for _, p := range []*Property{axis.Property, facing.Property, level.Property, half.Property} {
+		if err := log.AddProperty(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 + 3 + 3 + 1 bits
+	if log.stateBits != 9 {
+		t.Error(log.stateBits)
+	}
+
+	block := Block(0).ChangeType(log).Activate(true)
+	block = axis.Set(block, AxisZ)
+	block = facing.Set(block, FacingWest)
+	block = level.Set(block, 5)
+	block = half.Set(block, HalfTop)
+	if axis.Get(block) != AxisZ || facing.Get(block) != FacingWest || level.Get(block) != 5 || half.Get(block) != HalfTop {
+		t.Error(axis.Get(block), facing.Get(block), level.Get(block), half.Get(block))
+	}
+	if block.TypeID() != 5 || !block.Active() {
+		t.Error()
+	}
+
+	// the properties don't affect each other
+	block = level.Set(block, 100)
+	if level.Get(block) != 7 || facing.Get(block) != FacingWest || half.Get(block) != HalfTop {
+		t.Error()
+	}
+	if block.Activate(false).State() != block.State() {
+		t.Error("deactivating lost the state")
+	}
+
+	if facing.Value(block) != "west" || log.Property("axis").Value(block) != "z" {
+		t.Error()
+	}
+	if b, ok := facing.WithValue(block, "up"); !ok || facing.Get(b) != FacingUp {
+		t.Error()
+	}
+	if _, ok := facing.WithValue(block, "sideways"); ok {
+		t.Error()
+	}
+
+	// the state belongs to the type
+	if block.ChangeType(&BlockType{ID: 6}).State() != 0 {
+		t.Error()
+	}
+}
+
+func TestBlockPropertyErrors(t *testing.T) {
+	a := &BlockType{ID: 1}
+	b := &BlockType{ID: 2}
+	facing := NewFacingProperty()
+	if a.AddProperty(facing.Property) != nil || b.AddProperty(facing.Property) == nil {
+		t.Error("property was shared")
+	}
+	if a.AddProperty(NewFacingProperty().Property) == nil {
+		t.Error("duplicate name")
+	}
+	if a.AddProperty(NewLevelProperty("big", 1<<13).Property) != errStateFull {
+		t.Error("too many bits")
+	}
+}
+
+func TestBlockStateStorage(t *testing.T) {
+	slab := &BlockType{ID: 3}
+	half := NewHalfProperty()
+	level := NewLevelProperty("level", 15)
+	slab.AddProperty(half.Property)
+	slab.AddProperty(level.Property)
+
+	// states survive the palette & the serialization
+	chunk := NewChunk(0, 0, 0)
+	for i := 0; i < ChunkXYZ; i++ {
+		block := level.Set(Block(0).ChangeType(slab).Activate(true), i%16)
+		chunk.blocks.Set(i, half.Set(block, Half(i%2)))
+	}
+	data, _ := chunk.blocks.MarshalBinary()
+	decoded := NewChunk(0, 0, 0)
+	if err := decoded.blocks.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < ChunkXYZ; i++ {
+		block := decoded.blocks.Get(i)
+		if level.Get(block) != i%16 || half.Get(block) != Half(i%2) || block.TypeID() != 3 {
+			t.Fatalf("block %v lost its state", i)
+		}
+	}
+}
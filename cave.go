@@ -0,0 +1,112 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import "math"
+
+type CaveMode int
+
+const (
+	// CaveCheese carves big open caverns where the noise exceeds the threshold
+	CaveCheese CaveMode = iota
+	// CaveWorm carves tunnels where the isosurfaces of two noise fields intersect
+	CaveWorm
+)
+
+// CaveCarver removes blocks from generated chunks based on 3D noise. The noise is sampled at
+// world coordinates, so caves continue seamlessly across chunk borders in all axes.
+type CaveCarver struct {
+	Mode CaveMode
+
+	// Scale is the noise frequency per block. Threshold is the noise value above which a
+	// cheese cave is carved, or the tunnel radius in noise units for worm caves.
+	Scale     float64
+	Threshold float64
+
+	Octaves     int
+	Persistence float64
+	Lacunarity  float64
+
+	// caves are only carved between MinY and MaxY (world y, exclusive)
+	MinY int
+	MaxY int
+
+	noise  *SimplexNoise
+	noise2 *SimplexNoise
+}
+
+func NewCaveCarver(seed int64, mode CaveMode) *CaveCarver {
+	c := &CaveCarver{
+		Mode:        mode,
+		Octaves:     2,
+		Persistence: 0.5,
+		Lacunarity:  2,
+		MinY:        math.MinInt32,
+		MaxY:        math.MaxInt32,
+		noise:       NewSimplex(int64(HashCoords(seed, 3, 0, 0))),
+		noise2:      NewSimplex(int64(HashCoords(seed, 4, 0, 0))),
+	}
+	if mode == CaveWorm {
+		c.Scale = 1.0 / 48
+		c.Threshold = 0.03
+	} else {
+		c.Scale = 1.0 / 32
+		c.Threshold = 0.7
+	}
+	return c
+}
+
+// Carved reports whether the block at the given world position is part of a cave
+func (c *CaveCarver) Carved(x, y, z int) bool {
+	if y < c.MinY || y >= c.MaxY {
+		return false
+	}
+
+	fx := float64(x) * c.Scale
+	fy := float64(y) * c.Scale
+	fz := float64(z) * c.Scale
+	n := c.noise.Simplex3(fx, fy, fz, c.Octaves, c.Persistence, c.Lacunarity)
+	if c.Mode == CaveCheese {
+		return n > c.Threshold
+	}
+	if math.Abs(n-0.5) > c.Threshold {
+		return false
+	}
+	n2 := c.noise2.Simplex3(fx, fy, fz, c.Octaves, c.Persistence, c.Lacunarity)
+	return math.Abs(n2-0.5) <= c.Threshold
+}
+
+// Carve deactivates all blocks of the chunk, that are part of a cave
+func (c *CaveCarver) Carve(chunk *Chunk) {
+	baseY := chunk.Position.Y * ChunkHeight
+	if baseY+ChunkHeight <= c.MinY || baseY >= c.MaxY {
+		return
+	}
+
+	baseX := chunk.Position.X * ChunkWidth
+	baseZ := chunk.Position.Z * ChunkDepth
+	for y := 0; y < ChunkHeight; y++ {
+		for z := 0; z < ChunkDepth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				block := chunk.Get(x, y, z)
+				if !block.Active() {
+					continue
+				}
+				if c.Carved(baseX+x, baseY+y, baseZ+z) {
+					chunk.Set(x, y, z, BlockNil)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import "testing"
+
+func TestSimplex3(t *testing.T) {
+	noise := NewSimplex(42)
+	for i := 0; i < 100; i++ {
+		x, y, z := float64(i)*0.37, float64(i)*-0.21, float64(i)*0.13
+		n := noise.Simplex3(x, y, z, 4, 0.5, 2)
+		if n < 0 || n > 1 {
+			t.Errorf("noise %v out of range", n)
+		}
+		if n != NewSimplex(42).Simplex3(x, y, z, 4, 0.5, 2) {
+			t.Error()
+		}
+	}
+}
+
+func solidChunk(x, y, z int) *Chunk {
+	c := NewChunk(x, y, z)
+	for i := 0; i < ChunkXYZ; i++ {
+		c.blocks.Set(i, Block(1).Activate(true))
+	}
+	return c
+}
+
+func testCarving(t *testing.T, carver *CaveCarver) {
+	carved := 0
+	for _, pos := range testPositions(1) {
+		c := solidChunk(pos.X, pos.Y, pos.Z)
+		carver.Carve(c)
+
+		// every block must match the carver at its world position, so the caves are
+		// continuous across the borders of all neighbor chunks
+		for y := 0; y < ChunkHeight; y++ {
+			for z := 0; z < ChunkDepth; z++ {
+				for x := 0; x < ChunkWidth; x++ {
+					wx := pos.X*ChunkWidth + x
+					wy := pos.Y*ChunkHeight + y
+					wz := pos.Z*ChunkDepth + z
+					want := !carver.Carved(wx, wy, wz)
+					if c.Get(x, y, z).Active() != want {
+						t.Fatalf("block %v,%v,%v is active: %v", wx, wy, wz, !want)
+					}
+					if !want {
+						carved++
+					}
+				}
+			}
+		}
+	}
+	if carved == 0 || carved == len(testPositions(1))*ChunkXYZ {
+		t.Errorf("carved %v blocks", carved)
+	}
+}
+
+func TestCheeseCaves(t *testing.T) {
+	carver := NewCaveCarver(16726, CaveCheese)
+	carver.Scale = 1.0 / 8
+	carver.Threshold = 0.6
+	testCarving(t, carver)
+}
+
+func TestWormCaves(t *testing.T) {
+	carver := NewCaveCarver(16726, CaveWorm)
+	carver.Scale = 1.0 / 8
+	carver.Threshold = 0.1
+	testCarving(t, carver)
+}
+
+func TestCaveBounds(t *testing.T) {
+	carver := NewCaveCarver(16726, CaveCheese)
+	carver.Threshold = 0
+	carver.MinY = -4
+	carver.MaxY = 4
+
+	c := solidChunk(0, 0, 0)
+	carver.Carve(c)
+	for y := 0; y < ChunkHeight; y++ {
+		if c.Get(0, y, 0).Active() != (y >= 4) {
+			t.Errorf("block at y %v", y)
+		}
+	}
+	c = solidChunk(0, -1, 0)
+	carver.Carve(c)
+	for y := 0; y < ChunkHeight; y++ {
+		if c.Get(0, y, 0).Active() != (y < ChunkHeight-4) {
+			t.Errorf("block at y %v", y-ChunkHeight)
+		}
+	}
+}
+
+func TestCaveGeneratorDeterministic(t *testing.T) {
+	checkDeterministic(t, func() Generator {
+		gen := newBiomeGenerator()
+		gen.Caves = NewCaveCarver(16726, CaveWorm)
+		return gen
+	})
+}
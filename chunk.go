@@ -50,9 +50,19 @@ func (p *ChunkPosition) String() string {
 
 type Chunk struct {
 	Position ChunkPosition
-	Blocks   [ChunkXYZ]Block
+	blocks   PaletteStorage
 	Mesh     *Mesh
 	meshData *MeshData
+	// true if blocks were changed since the chunk was loaded or generated
+	modified bool
+	// true if the chunk was generated & the Decorator has not placed its features yet
+	needsDecoration bool
+	// indices of the blocks placed by features
+	decorated map[int]bool
+	// feature writes of a DecorationStage into the neighbors, that still need to be applied
+	features map[ChunkPosition]featureWrites
+	// the light levels of the blocks, nil if the chunk is completely dark. See lightEngine.
+	light []uint8
 
 	left   *Chunk
 	right  *Chunk
@@ -73,11 +83,11 @@ func (c *Chunk) Get(x, y, z int) Block {
 		return BlockNil
 	}
 
-	return c.Blocks[x+z*ChunkDepth+y*ChunkXZ]
+	return c.blocks.Get(x + z*ChunkDepth + y*ChunkXZ)
 }
 
 func (c *Chunk) Set(x, y, z int, block Block) {
-	c.Blocks[x+z*ChunkDepth+y*ChunkXZ] = block
+	c.blocks.Set(x+z*ChunkDepth+y*ChunkXZ, block)
 }
 
 func (c *Chunk) IndexAt(x, y, z int) int {
@@ -112,6 +122,7 @@ func (c *Chunk) setNeighbors(chunks map[ChunkPosition]*Chunk) {
 	}
 }
 
+// unsetNeighbors removes the chunk from its neighbors and vice versa.
 func (c *Chunk) unsetNeighbors() {
 	if c.left != nil {
 		c.left.right = nil
@@ -131,4 +142,5 @@ func (c *Chunk) unsetNeighbors() {
 	if c.back != nil {
 		c.back.front = nil
 	}
+	c.left, c.right, c.top, c.bottom, c.front, c.back = nil, nil, nil, nil, nil, nil
 }
@@ -13,6 +13,159 @@
 
 package vox
 
+import (
+	"container/list"
+	"log"
+	"sync"
+)
+
+// ChunkProvider is the source of all chunks of a World. GetChunk is called by the world
+// workers, so implementations must be safe for concurrent use.
 type ChunkProvider interface {
+	// GetChunk returns the chunk at the given chunk-coordinates or nil, if the provider has none.
 	GetChunk(x, y, z int) *Chunk
+	// ReleaseChunk is called after the world unloaded the chunk.
+	ReleaseChunk(chunk *Chunk)
+}
+
+// ----------------------------------------------------------------------------
+
+// GeneratorProvider generates every requested chunk.
+type GeneratorProvider struct {
+	generator Generator
+	bank      *BlockBank
+}
+
+func NewGeneratorProvider(generator Generator, bank *BlockBank) *GeneratorProvider {
+	return &GeneratorProvider{generator: generator, bank: bank}
+}
+
+func (p *GeneratorProvider) GetChunk(x, y, z int) *Chunk {
+	chunk := p.generator.GenerateChunkAt(x, y, z, p.bank)
+	if chunk != nil {
+		chunk.needsDecoration = true
+	}
+	return chunk
+}
+
+func (p *GeneratorProvider) ReleaseChunk(chunk *Chunk) {
+}
+
+// ----------------------------------------------------------------------------
+
+// StoreProvider loads chunks from a ChunkStore & saves modified chunks, when they are released.
+type StoreProvider struct {
+	store ChunkStore
+}
+
+func NewStoreProvider(store ChunkStore) *StoreProvider {
+	return &StoreProvider{store: store}
+}
+
+func (p *StoreProvider) GetChunk(x, y, z int) *Chunk {
+	pos := ChunkPosition{x, y, z}
+	chunk, err := p.store.LoadChunk(pos)
+	if err != nil {
+		log.Printf("failed to load chunk %v: %v", pos.String(), err)
+		return nil
+	}
+	return chunk
+}
+
+func (p *StoreProvider) ReleaseChunk(chunk *Chunk) {
+	if !chunk.modified {
+		return
+	}
+
+	if err := p.store.SaveChunk(chunk); err != nil {
+		log.Printf("failed to save chunk %v: %v", chunk.Position.String(), err)
+		return
+	}
+	chunk.modified = false
+}
+
+// ----------------------------------------------------------------------------
+
+// CacheProvider keeps the most recently released chunks in memory. If a chunk is loaded again
+// shortly after it was unloaded, it doesn't need to be loaded from disk or generated again.
+type CacheProvider struct {
+	capacity int
+	mutex    sync.Mutex
+	lru      *list.List
+	chunks   map[ChunkPosition]*list.Element
+}
+
+// NewCacheProvider creates a cache, that holds at most capacity chunks.
+func NewCacheProvider(capacity int) *CacheProvider {
+	return &CacheProvider{
+		capacity: capacity,
+		lru:      list.New(),
+		chunks:   make(map[ChunkPosition]*list.Element),
+	}
+}
+
+// GetChunk removes the chunk from the cache & returns it.
+func (p *CacheProvider) GetChunk(x, y, z int) *Chunk {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pos := ChunkPosition{x, y, z}
+	if elem, ok := p.chunks[pos]; ok {
+		p.lru.Remove(elem)
+		delete(p.chunks, pos)
+		return elem.Value.(*Chunk)
+	}
+	return nil
+}
+
+// ReleaseChunk puts the chunk into the cache. If the cache is full, the least recently released
+// chunk is dropped.
+func (p *CacheProvider) ReleaseChunk(chunk *Chunk) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if elem, ok := p.chunks[chunk.Position]; ok {
+		p.lru.Remove(elem)
+	}
+	p.chunks[chunk.Position] = p.lru.PushFront(chunk)
+
+	for p.lru.Len() > p.capacity {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.chunks, oldest.Value.(*Chunk).Position)
+	}
+}
+
+// Len returns the number of cached chunks.
+func (p *CacheProvider) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.lru.Len()
+}
+
+// ----------------------------------------------------------------------------
+
+// ChainProvider asks its providers in order for a chunk & returns the first one found.
+// Released chunks are passed to all providers.
+type ChainProvider struct {
+	providers []ChunkProvider
+}
+
+func NewChainProvider(providers ...ChunkProvider) *ChainProvider {
+	return &ChainProvider{providers: providers}
+}
+
+func (p *ChainProvider) GetChunk(x, y, z int) *Chunk {
+	for _, provider := range p.providers {
+		if chunk := provider.GetChunk(x, y, z); chunk != nil {
+			return chunk
+		}
+	}
+	return nil
+}
+
+func (p *ChainProvider) ReleaseChunk(chunk *Chunk) {
+	for _, provider := range p.providers {
+		provider.ReleaseChunk(chunk)
+	}
 }
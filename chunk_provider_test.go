@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"os"
+	"testing"
+)
+
+// fixtureProvider only knows a fixed set of chunks, like a prebuilt map
+type fixtureProvider struct {
+	chunks   map[ChunkPosition]*Chunk
+	released int
+}
+
+func (p *fixtureProvider) GetChunk(x, y, z int) *Chunk {
+	return p.chunks[ChunkPosition{x, y, z}]
+}
+
+func (p *fixtureProvider) ReleaseChunk(chunk *Chunk) {
+	p.released++
+}
+
+func TestCacheProvider(t *testing.T) {
+	cache := NewCacheProvider(2)
+	a, b, c := NewChunk(0, 0, 0), NewChunk(1, 0, 0), NewChunk(2, 0, 0)
+	cache.ReleaseChunk(a)
+	cache.ReleaseChunk(b)
+	cache.ReleaseChunk(a)
+	cache.ReleaseChunk(c)
+
+	// b is the least recently released chunk
+	if cache.Len() != 2 || cache.GetChunk(1, 0, 0) != nil {
+		t.Error(cache.Len())
+	}
+	if cache.GetChunk(0, 0, 0) != a || cache.GetChunk(2, 0, 0) != c {
+		t.Error()
+	}
+
+	// chunks are handed out only once
+	if cache.Len() != 0 || cache.GetChunk(0, 0, 0) != nil {
+		t.Error()
+	}
+}
+
+func TestChainProvider(t *testing.T) {
+	bank := newTestBank()
+	fixture := &fixtureProvider{chunks: map[ChunkPosition]*Chunk{{0, 0, 0}: NewChunk(0, 0, 0)}}
+	chain := NewChainProvider(fixture, NewGeneratorProvider(&FlatGenerator{}, bank))
+
+	if chain.GetChunk(0, 0, 0) != fixture.chunks[ChunkPosition{0, 0, 0}] {
+		t.Error()
+	}
+	chunk := chain.GetChunk(1, 0, 0)
+	if chunk == nil || !chunk.Get(0, 0, 0).Active() {
+		t.Error()
+	}
+	chain.ReleaseChunk(chunk)
+	if fixture.released != 1 {
+		t.Error()
+	}
+}
+
+func TestWorldFixtureProvider(t *testing.T) {
+	fixture := &fixtureProvider{chunks: map[ChunkPosition]*Chunk{{0, 0, 0}: NewChunk(0, 0, 0)}}
+	world := NewWorld(newTestBank(), &GreedyMesher{}, fixture)
+	world.Workers = 0
+	world.GenerateNewChunk(0, 0, 0)
+	world.GenerateNewChunk(1, 0, 0)
+	world.processGenerating()
+
+	// chunks the provider doesn't have are not loaded
+	if len(world.allChunks) != 1 || world.allChunks[ChunkPosition{0, 0, 0}] == nil {
+		t.Error(len(world.allChunks))
+	}
+
+	world.RemoveChunk(0, 0, 0)
+	if fixture.released != 1 {
+		t.Error()
+	}
+}
+
+func TestWorldStoreProvider(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+	defer store.Close()
+
+	bank := newTestBank()
+	cache := NewCacheProvider(8)
+	provider := NewChainProvider(cache, NewStoreProvider(store), NewGeneratorProvider(&FlatGenerator{}, bank))
+	world := NewWorld(bank, &GreedyMesher{}, provider)
+	world.Workers = 0
+	world.GenerateNewChunk(0, 0, 0)
+	world.GenerateNewChunk(1, 0, 0)
+	world.processGenerating()
+
+	world.SetBlock(3, 4, 5, BlockNil)
+
+	// only modified chunks are saved
+	world.RemoveChunk(0, 0, 0)
+	world.RemoveChunk(1, 0, 0)
+	if chunk, _ := store.LoadChunk(ChunkPosition{1, 0, 0}); chunk != nil {
+		t.Error("unmodified chunk was saved")
+	}
+	if chunk, _ := store.LoadChunk(ChunkPosition{0, 0, 0}); chunk == nil || chunk.Get(3, 4, 5) != BlockNil {
+		t.Error("modified chunk was not saved")
+	}
+
+	// restored from the cache
+	world.GenerateNewChunk(0, 0, 0)
+	world.processGenerating()
+	if world.GetBlock(3, 4, 5) != BlockNil || world.GetBlock(3, 4, 6) == BlockNil || cache.Len() != 1 {
+		t.Error("chunk was not restored from cache")
+	}
+
+	// restored from disk
+	world.RemoveChunk(0, 0, 0)
+	cache.GetChunk(0, 0, 0)
+	world.GenerateNewChunk(0, 0, 0)
+	world.processGenerating()
+	if world.GetBlock(3, 4, 5) != BlockNil || world.GetBlock(3, 4, 6) == BlockNil {
+		t.Error("chunk was not restored from disk")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import "container/heap"
+
+// chunkQueue is a priority queue of chunk positions & their chunks. Positions with the
+// lowest priority value are popped first. Every position is at most once in the queue.
+type chunkQueue struct {
+	heap     chunkHeap
+	items    map[ChunkPosition]*chunkQueueItem
+	priority func(pos ChunkPosition) float32
+}
+
+type chunkQueueItem struct {
+	pos      ChunkPosition
+	chunk    *Chunk
+	priority float32
+	index    int
+}
+
+func newChunkQueue(priority func(pos ChunkPosition) float32) *chunkQueue {
+	return &chunkQueue{
+		items:    make(map[ChunkPosition]*chunkQueueItem),
+		priority: priority,
+	}
+}
+
+func (q *chunkQueue) len() int {
+	return len(q.heap)
+}
+
+// put adds the position to the queue. If it's already queued only the chunk is updated.
+func (q *chunkQueue) put(pos ChunkPosition, chunk *Chunk) {
+	if item, ok := q.items[pos]; ok {
+		item.chunk = chunk
+		return
+	}
+
+	item := &chunkQueueItem{pos: pos, chunk: chunk, priority: q.priority(pos)}
+	q.items[pos] = item
+	heap.Push(&q.heap, item)
+}
+
+func (q *chunkQueue) remove(pos ChunkPosition) {
+	if item, ok := q.items[pos]; ok {
+		heap.Remove(&q.heap, item.index)
+		delete(q.items, pos)
+	}
+}
+
+// pop removes & returns the position with the highest priority.
+func (q *chunkQueue) pop() (ChunkPosition, *Chunk) {
+	item := heap.Pop(&q.heap).(*chunkQueueItem)
+	delete(q.items, item.pos)
+	return item.pos, item.chunk
+}
+
+// reprioritize calculates the priorities of all queued positions again.
+func (q *chunkQueue) reprioritize() {
+	for _, item := range q.heap {
+		item.priority = q.priority(item.pos)
+	}
+	heap.Init(&q.heap)
+}
+
+// chunkHeap implements heap.Interface
+type chunkHeap []*chunkQueueItem
+
+func (h chunkHeap) Len() int {
+	return len(h)
+}
+
+func (h chunkHeap) Less(i, j int) bool {
+	return h[i].priority < h[j].priority
+}
+
+func (h chunkHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *chunkHeap) Push(x interface{}) {
+	item := x.(*chunkQueueItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *chunkHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"testing"
+
+	"github.com/mbrlabs/vox/glm"
+)
+
+func (q *chunkQueue) contains(pos ChunkPosition) bool {
+	_, ok := q.items[pos]
+	return ok
+}
+
+func (q *chunkQueue) clear() {
+	q.heap = nil
+	q.items = make(map[ChunkPosition]*chunkQueueItem)
+}
+
+func TestChunkQueueOrder(t *testing.T) {
+	focus := ChunkPosition{}
+	q := newChunkQueue(func(pos ChunkPosition) float32 {
+		return pos.Distance(&focus)
+	})
+
+	for x := 5; x >= -5; x-- {
+		q.put(ChunkPosition{x, 0, 0}, nil)
+	}
+	q.put(ChunkPosition{0, 0, 0}, NewChunk(0, 0, 0))
+	q.remove(ChunkPosition{1, 0, 0})
+	if q.len() != 10 {
+		t.Fatal(q.len())
+	}
+
+	pos, chunk := q.pop()
+	if pos != (ChunkPosition{0, 0, 0}) || chunk == nil {
+		t.Error(pos)
+	}
+	pos, _ = q.pop()
+	if pos != (ChunkPosition{-1, 0, 0}) {
+		t.Error(pos)
+	}
+
+	// move the focus to the other end
+	focus.Set(5, 0, 0)
+	q.reprioritize()
+	var last float32
+	for i := 0; q.len() > 0; i++ {
+		pos, _ = q.pop()
+		if i == 0 && pos.X != 5 {
+			t.Error(pos)
+		}
+		dist := pos.Distance(&focus)
+		if dist < last {
+			t.Error("queue not ordered")
+		}
+		last = dist
+	}
+}
+
+func TestWorldFocus(t *testing.T) {
+	world := newFlatWorld()
+	world.ViewBias = 0.5
+	world.SetFocus(ChunkPosition{}, &glm.Vector3{X: 1})
+	for x := -4; x <= 4; x++ {
+		world.GenerateNewChunk(x, 0, 0)
+	}
+
+	pos, _ := world.generatingNeeded.pop()
+	if pos != (ChunkPosition{0, 0, 0}) {
+		t.Error(pos)
+	}
+	// in view direction
+	pos, _ = world.generatingNeeded.pop()
+	if pos != (ChunkPosition{1, 0, 0}) {
+		t.Error(pos)
+	}
+
+	// turn around
+	world.SetFocus(ChunkPosition{}, &glm.Vector3{X: -1})
+	pos, _ = world.generatingNeeded.pop()
+	if pos != (ChunkPosition{-1, 0, 0}) {
+		t.Error(pos)
+	}
+
+	// walk to the end
+	world.SetFocus(ChunkPosition{4, 0, 0}, &glm.Vector3{X: -1})
+	pos, _ = world.generatingNeeded.pop()
+	if pos != (ChunkPosition{4, 0, 0}) {
+		t.Error(pos)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ChunkStore persists the blocks of chunks. Implementations must be safe for concurrent use,
+// because chunks are loaded by the world workers.
+type ChunkStore interface {
+	// LoadChunk returns the stored chunk at the given position or nil, if it was never saved.
+	LoadChunk(pos ChunkPosition) (*Chunk, error)
+	SaveChunk(chunk *Chunk) error
+	Close() error
+}
+
+// ----------------------------------------------------------------------------
+
+const (
+	// RegionSize is the number of chunks along the x and z axis in a region file.
+	// Every chunk layer has its own region files.
+	RegionSize = 32
+
+	regionMagic      = "VOXR"
+	regionVersion    = 2
+	regionTableStart = 8
+	regionHeaderSize = regionTableStart + RegionSize*RegionSize*8
+)
+
+// regionMaxSize is the largest size of a region file, the table can only address 4 GiB
+var regionMaxSize int64 = math.MaxUint32
+
+var errRegionFull = errors.New("region file is full")
+
+// RegionStore is a ChunkStore that groups RegionSize x RegionSize chunks into a single file.
+//
+// A region file starts with a header: the magic "VOXR", a uint32 version and a table with the offset
+// & length (both uint32) of every chunk in the file. An offset of 0 means that the chunk is not stored.
+// The chunks are zlib compressed. Saving a chunk appends it to the file & updates the table.
+// The old versions of saved chunks stay in the file, until they take more space than the current
+// ones or the table can't address the end of the file anymore. Then the region file is compacted.
+type RegionStore struct {
+	dir     string
+	mutex   sync.Mutex
+	regions map[ChunkPosition]*os.File
+}
+
+// NewRegionStore creates a store that keeps its region files in the given directory.
+func NewRegionStore(dir string) (*RegionStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &RegionStore{
+		dir:     dir,
+		regions: make(map[ChunkPosition]*os.File),
+	}, nil
+}
+
+func (s *RegionStore) LoadChunk(pos ChunkPosition) (*Chunk, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	region, index := s.regionOf(pos)
+	file, err := s.open(region, false)
+	if file == nil || err != nil {
+		return nil, err
+	}
+
+	// look up the table entry
+	var entry [2]uint32
+	if err := s.readAt(file, regionTableStart+int64(index)*8, &entry); err != nil {
+		return nil, err
+	}
+	offset, length := entry[0], entry[1]
+	if offset == 0 {
+		return nil, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset < regionHeaderSize || int64(offset)+int64(length) > info.Size() {
+		return nil, s.corrupt(file, fmt.Sprintf("invalid table entry for %v", pos.String()))
+	}
+
+	// read & decompress the chunk
+	compressed := make([]byte, length)
+	if _, err := file.ReadAt(compressed, int64(offset)); err != nil {
+		return nil, err
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, s.corrupt(file, err.Error())
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, s.corrupt(file, err.Error())
+	}
+
+	chunk := NewChunk(pos.X, pos.Y, pos.Z)
+	if err := chunk.blocks.UnmarshalBinary(data); err != nil {
+		return nil, s.corrupt(file, err.Error())
+	}
+
+	return chunk, nil
+}
+
+func (s *RegionStore) SaveChunk(chunk *Chunk) error {
+	// compress outside of the lock
+	data, err := chunk.blocks.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	compressed := &bytes.Buffer{}
+	writer := zlib.NewWriter(compressed)
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	region, index := s.regionOf(chunk.Position)
+	file, err := s.open(region, true)
+	if err != nil {
+		return err
+	}
+
+	// append the chunk first, so the table never points to incomplete data
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+	if offset+int64(compressed.Len()) > regionMaxSize {
+		if file, err = s.compact(region, file); err != nil {
+			return err
+		}
+		if info, err = file.Stat(); err != nil {
+			return err
+		}
+		offset = info.Size()
+		if offset+int64(compressed.Len()) > regionMaxSize {
+			return errRegionFull
+		}
+	}
+	if _, err := file.WriteAt(compressed.Bytes(), offset); err != nil {
+		return err
+	}
+
+	entry := [2]uint32{uint32(offset), uint32(compressed.Len())}
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, entry); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(buf.Bytes(), regionTableStart+int64(index)*8); err != nil {
+		return err
+	}
+
+	// drop the old versions, once they are larger than the current ones
+	live, err := s.liveSize(file)
+	if err != nil {
+		return err
+	}
+	if offset+int64(compressed.Len())-regionHeaderSize-live > live {
+		_, err = s.compact(region, file)
+	}
+	return err
+}
+
+// liveSize returns the number of bytes of the current versions of the chunks in the file.
+func (s *RegionStore) liveSize(file *os.File) (int64, error) {
+	var table [RegionSize * RegionSize][2]uint32
+	if err := s.readAt(file, regionTableStart, &table); err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, entry := range table {
+		if entry[0] != 0 {
+			size += int64(entry[1])
+		}
+	}
+	return size, nil
+}
+
+// compact rewrites the region file without the old versions of the chunks. The new file is
+// written next to the old one & replaces it, once it is complete.
+func (s *RegionStore) compact(region ChunkPosition, file *os.File) (*os.File, error) {
+	var table [RegionSize * RegionSize][2]uint32
+	if err := s.readAt(file, regionTableStart, &table); err != nil {
+		return nil, err
+	}
+
+	path := s.path(region)
+	compacted, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*os.File, error) {
+		compacted.Close()
+		os.Remove(compacted.Name())
+		return nil, err
+	}
+
+	offset := int64(regionHeaderSize)
+	for i, entry := range table {
+		if entry[0] == 0 {
+			continue
+		}
+		chunk := make([]byte, entry[1])
+		if _, err := file.ReadAt(chunk, int64(entry[0])); err != nil {
+			return fail(err)
+		}
+		if _, err := compacted.WriteAt(chunk, offset); err != nil {
+			return fail(err)
+		}
+		table[i][0] = uint32(offset)
+		offset += int64(entry[1])
+	}
+
+	header := &bytes.Buffer{}
+	header.WriteString(regionMagic)
+	if err := binary.Write(header, binary.LittleEndian, uint32(regionVersion)); err != nil {
+		return fail(err)
+	}
+	if err := binary.Write(header, binary.LittleEndian, &table); err != nil {
+		return fail(err)
+	}
+	if _, err := compacted.WriteAt(header.Bytes(), 0); err != nil {
+		return fail(err)
+	}
+	if err := compacted.Sync(); err != nil {
+		return fail(err)
+	}
+
+	file.Close()
+	delete(s.regions, region)
+	if err := os.Rename(compacted.Name(), path); err != nil {
+		compacted.Close()
+		return nil, err
+	}
+	s.regions[region] = compacted
+	return compacted, nil
+}
+
+// Close closes all open region files.
+func (s *RegionStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var firstErr error
+	for region, file := range s.regions {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.regions, region)
+	}
+	return firstErr
+}
+
+// regionOf returns the position of the region that contains the chunk & the index of the chunk in the region.
+func (s *RegionStore) regionOf(pos ChunkPosition) (ChunkPosition, int) {
+	rx := FloorDiv(pos.X, RegionSize)
+	rz := FloorDiv(pos.Z, RegionSize)
+	index := (pos.X - rx*RegionSize) + (pos.Z-rz*RegionSize)*RegionSize
+	return ChunkPosition{rx, pos.Y, rz}, index
+}
+
+func (s *RegionStore) path(region ChunkPosition) string {
+	return filepath.Join(s.dir, fmt.Sprintf("r.%d.%d.%d.region", region.X, region.Y, region.Z))
+}
+
+// open returns the region file. If create is false & the file doesn't exist, nil is returned.
+func (s *RegionStore) open(region ChunkPosition, create bool) (*os.File, error) {
+	if file, ok := s.regions[region]; ok {
+		return file, nil
+	}
+
+	path := s.path(region)
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		if !create {
+			return nil, nil
+		}
+		return s.create(region, path)
+	} else if err != nil {
+		return nil, err
+	}
+
+	// validate the header
+	header := make([]byte, regionTableStart)
+	info, err := file.Stat()
+	if err == nil {
+		_, err = file.ReadAt(header, 0)
+	}
+	if err != nil || info.Size() < regionHeaderSize || string(header[:4]) != regionMagic {
+		file.Close()
+		return nil, fmt.Errorf("corrupt region file %v: invalid header", path)
+	}
+	if version := binary.LittleEndian.Uint32(header[4:]); version != regionVersion {
+		file.Close()
+		return nil, fmt.Errorf("unsupported region file version %v in %v", version, path)
+	}
+
+	s.regions[region] = file
+	return file, nil
+}
+
+func (s *RegionStore) create(region ChunkPosition, path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, regionHeaderSize)
+	copy(header, regionMagic)
+	binary.LittleEndian.PutUint32(header[4:], regionVersion)
+	if _, err := file.WriteAt(header, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.regions[region] = file
+	return file, nil
+}
+
+func (s *RegionStore) readAt(file *os.File, offset int64, data interface{}) error {
+	buf := make([]byte, binary.Size(data))
+	if _, err := file.ReadAt(buf, offset); err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(buf), binary.LittleEndian, data)
+}
+
+func (s *RegionStore) corrupt(file *os.File, reason string) error {
+	return fmt.Errorf("corrupt region file %v: %v", file.Name(), reason)
+}
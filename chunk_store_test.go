@@ -0,0 +1,237 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func newTestStore(t *testing.T) (*RegionStore, string) {
+	dir, err := ioutil.TempDir("", "vox-regions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewRegionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func randomChunk(x, y, z int, types int, seed int64) *Chunk {
+	rnd := rand.New(rand.NewSource(seed))
+	chunk := NewChunk(x, y, z)
+	for i := 0; i < ChunkXYZ; i++ {
+		chunk.blocks.Set(i, Block(rnd.Intn(types)).Activate(rnd.Intn(2) == 0))
+	}
+	return chunk
+}
+
+func equalBlocks(a, b *Chunk) bool {
+	for i := 0; i < ChunkXYZ; i++ {
+		if a.blocks.Get(i) != b.blocks.Get(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRegionStoreRoundTrip(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	chunks := []*Chunk{
+		randomChunk(0, 0, 0, 5, 1),
+		randomChunk(-1, 0, -33, 300, 2),
+		randomChunk(31, -2, 31, 1, 3),
+		NewChunk(40, 3, -7),
+	}
+	for _, chunk := range chunks {
+		if err := store.SaveChunk(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// overwrite a chunk
+	chunks[0] = randomChunk(0, 0, 0, 2, 4)
+	if err := store.SaveChunk(chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// load with a new store
+	store, _ = NewRegionStore(dir)
+	defer store.Close()
+	for _, chunk := range chunks {
+		loaded, err := store.LoadChunk(chunk.Position)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded == nil || loaded.Position != chunk.Position || !equalBlocks(chunk, loaded) {
+			t.Errorf("chunk %v not restored", chunk.Position.String())
+		}
+	}
+
+	// chunks that were never saved
+	for _, pos := range []ChunkPosition{{1, 0, 0}, {0, 1, 0}, {-100, 0, 100}} {
+		loaded, err := store.LoadChunk(pos)
+		if loaded != nil || err != nil {
+			t.Error(pos, err)
+		}
+	}
+}
+
+func TestRegionStoreCompaction(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+	defer func(size int64) { regionMaxSize = size }(regionMaxSize)
+
+	kept := randomChunk(1, 0, 1, 5, 1)
+	store.SaveChunk(kept)
+	store.SaveChunk(randomChunk(2, 0, 1, 5, 2))
+	info, err := os.Stat(store.path(ChunkPosition{0, 0, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// room for two more chunks, the old versions are dropped when the file is full
+	regionMaxSize = 2*info.Size() - regionHeaderSize
+	var saved *Chunk
+	for i := int64(0); i < 10; i++ {
+		saved = randomChunk(2, 0, 1, 5, 2+i)
+		if err := store.SaveChunk(saved); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	if info, _ := os.Stat(store.path(ChunkPosition{0, 0, 0})); info.Size() > regionMaxSize {
+		t.Error(info.Size())
+	}
+	for _, chunk := range []*Chunk{kept, saved} {
+		loaded, err := store.LoadChunk(chunk.Position)
+		if err != nil || loaded == nil || !equalBlocks(chunk, loaded) {
+			t.Error(chunk.Position.String(), err)
+		}
+	}
+
+	// the chunk doesn't fit, even after the compaction
+	regionMaxSize = regionHeaderSize + 10
+	if err := store.SaveChunk(randomChunk(0, 0, 0, 5, 1)); err != errRegionFull {
+		t.Error(err)
+	}
+	if _, err := os.Stat(store.path(ChunkPosition{0, 0, 0}) + ".tmp"); !os.IsNotExist(err) {
+		t.Error(err)
+	}
+	store.Close()
+}
+
+func TestRegionStoreGrowth(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	chunks := []*Chunk{randomChunk(0, 0, 0, 5, 1), randomChunk(1, 0, 0, 5, 2), randomChunk(0, 0, 1, 5, 3)}
+	for _, chunk := range chunks {
+		store.SaveChunk(chunk)
+	}
+	path := store.path(ChunkPosition{0, 0, 0})
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := info.Size() - regionHeaderSize
+
+	// saving the same chunks over & over must not grow the file without bound
+	for i := int64(0); i < 100; i++ {
+		chunks[i%3] = randomChunk(chunks[i%3].Position.X, 0, chunks[i%3].Position.Z, 5, 10+i)
+		if err := store.SaveChunk(chunks[i%3]); err != nil {
+			t.Fatal(i, err)
+		}
+		if info, _ := os.Stat(path); info.Size() > regionHeaderSize+3*live {
+			t.Fatalf("region file has %v bytes after %v saves", info.Size(), i+1)
+		}
+	}
+	for _, chunk := range chunks {
+		loaded, err := store.LoadChunk(chunk.Position)
+		if err != nil || loaded == nil || !equalBlocks(chunk, loaded) {
+			t.Error(chunk.Position.String(), err)
+		}
+	}
+	store.Close()
+}
+
+func TestRegionStoreCorruption(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	chunk := randomChunk(3, 0, 4, 10, 1)
+	store.SaveChunk(randomChunk(5, 0, 4, 10, 2))
+	store.SaveChunk(chunk)
+	store.Close()
+
+	path := store.path(ChunkPosition{0, 0, 0})
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, index := store.regionOf(chunk.Position)
+	entry := regionTableStart + index*8
+
+	corruptions := map[string]func(data []byte) []byte{
+		"magic": func(data []byte) []byte {
+			data[0] = 'X'
+			return data
+		},
+		"version": func(data []byte) []byte {
+			data[4] = 99
+			return data
+		},
+		"truncated header": func(data []byte) []byte {
+			return data[:100]
+		},
+		"truncated chunk": func(data []byte) []byte {
+			return data[:len(data)-10]
+		},
+		"payload": func(data []byte) []byte {
+			offset := int(data[entry]) | int(data[entry+1])<<8 | int(data[entry+2])<<16
+			for i := offset + 10; i < offset+20; i++ {
+				data[i] ^= 0xFF
+			}
+			return data
+		},
+		"table": func(data []byte) []byte {
+			data[entry+6] = 0xFF
+			return data
+		},
+	}
+
+	for name, corrupt := range corruptions {
+		data := make([]byte, len(original))
+		copy(data, original)
+		if err := ioutil.WriteFile(path, corrupt(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		store, _ := NewRegionStore(dir)
+		loaded, err := store.LoadChunk(chunk.Position)
+		if err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+		if loaded != nil {
+			t.Errorf("%v: loaded corrupt chunk", name)
+		}
+		store.Close()
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// voxmap renders a top-down map of a generator into a png, without a window or GPU.
+//
+// Build it with the headless tag, so the vox package leaves out the window & OpenGL code. It
+// doesn't need a C compiler or the OpenGL & GLFW libraries then.
+//
+//	go build -tags headless ./cmd/voxmap
+//	voxmap -gen simplex -seed 42 -w 32 -d 32 -o map.png
+//	voxmap -config worldgen.json -mode height -biomes -o map.png
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mbrlabs/vox"
+)
+
+func main() {
+	genName := flag.String("gen", "simplex", "registered generator: "+strings.Join(vox.GeneratorNames(), ", "))
+	seed := flag.Int64("seed", 0, "seed of the generator")
+	configPath := flag.String("config", "", "json generator config, replaces -gen & -seed")
+	x := flag.Int("x", -8, "first chunk x")
+	z := flag.Int("z", -8, "first chunk z")
+	width := flag.Int("w", 16, "number of chunks along x")
+	depth := flag.Int("d", 16, "number of chunks along z")
+	minY := flag.Int("miny", -1, "lowest chunk layer")
+	maxY := flag.Int("maxy", 2, "highest chunk layer")
+	mode := flag.String("mode", "surface", "pixel color: surface or height")
+	biomes := flag.Bool("biomes", false, "blend the biomes over the map")
+	colors := flag.String("colors", "", "block colors, e.g. 1=808080,2=33aa33")
+	out := flag.String("o", "map.png", "output file")
+	flag.Parse()
+
+	opts := &vox.MapOptions{X: *x, Z: *z, Width: *width, Depth: *depth, MinY: *minY, MaxY: *maxY}
+	if *width <= 0 || *depth <= 0 || *minY > *maxY {
+		log.Fatal("invalid region")
+	}
+	switch *mode {
+	case "surface":
+		opts.Mode = vox.MapSurface
+	case "height":
+		opts.Mode = vox.MapHeight
+	default:
+		log.Fatalf("unknown mode %q", *mode)
+	}
+
+	var err error
+	if opts.Colors, err = parseColors(*colors); err != nil {
+		log.Fatal(err)
+	}
+
+	// generator & block types
+	bank := vox.NewBlockBank()
+	var gen vox.Generator
+	if *configPath != "" {
+		config, err := vox.LoadGeneratorConfig(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, id := range config.Blocks {
+			bank.AddType(&vox.BlockType{ID: id})
+		}
+		if gen, opts.Decorator, err = config.NewGenerator(bank); err != nil {
+			log.Fatal(err)
+		}
+		if *biomes {
+			opts.Biomes = config.BuildTerrain()
+		}
+	} else {
+		if gen, err = vox.NewGeneratorByName(*genName, *seed); err != nil {
+			log.Fatal(err)
+		}
+		for id := uint16(1); id <= 3; id++ {
+			bank.AddType(&vox.BlockType{ID: id})
+		}
+		if source, ok := gen.(vox.BiomeSource); ok && *biomes {
+			opts.Biomes = source
+		}
+	}
+	if *biomes && opts.Biomes == nil {
+		log.Fatal("the generator has no biomes")
+	}
+
+	img := vox.RenderMap(gen, bank, opts)
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %vx%v map to %v\n", img.Bounds().Dx(), img.Bounds().Dy(), *out)
+}
+
+// parseColors parses a list like 1=808080,2=33aa33 into block colors
+func parseColors(list string) (map[uint16]color.RGBA, error) {
+	colors := make(map[uint16]color.RGBA)
+	if list == "" {
+		return colors, nil
+	}
+	for _, entry := range strings.Split(list, ",") {
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid color %q", entry)
+		}
+		id, err := strconv.ParseUint(parts[0], 10, 15)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block id %q", parts[0])
+		}
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(parts[1], "#"), 16, 24)
+		if err != nil {
+			return nil, fmt.Errorf("invalid color %q", parts[1])
+		}
+		colors[uint16(id)] = color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}
+	}
+	return colors, nil
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import "math/rand"
+
+// Feature places a multi block structure like a tree, a rock or a ruin. Place reads the freshly
+// generated origin chunk (without any decorations) & writes the blocks of the feature through
+// the writer, also into neighboring chunks. Features are called concurrently by the world
+// workers, so they must not keep any state.
+type Feature interface {
+	Place(chunk *Chunk, rnd *rand.Rand, out *FeatureWriter)
+}
+
+// featureWrites are the blocks written into a single chunk, keyed by the block index
+type featureWrites map[int]Block
+
+// mergeFeatureBlock decides between two feature blocks at the same position. The higher block
+// wins, which makes the result independent of the order the features are placed in.
+func mergeFeatureBlock(writes featureWrites, index int, block Block) {
+	if old, ok := writes[index]; !ok || block > old {
+		writes[index] = block
+	}
+}
+
+// FeatureWriter collects the blocks of all features of one origin chunk. Blocks can only be
+// written into the origin chunk & its 26 direct neighbors.
+type FeatureWriter struct {
+	origin ChunkPosition
+	writes map[ChunkPosition]featureWrites
+}
+
+// Set writes an active block at the given world coordinates. Blocks only replace air. If two
+// features write the same block, the higher value wins.
+func (w *FeatureWriter) Set(x, y, z int, block Block) {
+	if !block.Active() {
+		return
+	}
+	cx := FloorDiv(x, ChunkWidth)
+	cy := FloorDiv(y, ChunkHeight)
+	cz := FloorDiv(z, ChunkDepth)
+	if cx < w.origin.X-1 || cx > w.origin.X+1 || cy < w.origin.Y-1 || cy > w.origin.Y+1 ||
+		cz < w.origin.Z-1 || cz > w.origin.Z+1 {
+		return
+	}
+
+	pos := ChunkPosition{cx, cy, cz}
+	writes := w.writes[pos]
+	if writes == nil {
+		writes = make(featureWrites)
+		w.writes[pos] = writes
+	}
+	mergeFeatureBlock(writes, (x-cx*ChunkWidth)+(z-cz*ChunkDepth)*ChunkDepth+(y-cy*ChunkHeight)*ChunkXZ, block)
+}
+
+// ----------------------------------------------------------------------------
+
+// featureOutput are the writes of a loaded origin chunk into its neighbors
+type featureOutput struct {
+	writes    map[ChunkPosition]featureWrites
+	delivered map[ChunkPosition]bool
+}
+
+// Decorator places features on freshly generated chunks. Features are seeded per chunk, so
+// the result does not depend on the order in which chunks are loaded. Writes into neighbors,
+// that are not loaded yet, are queued until the neighbor is loaded.
+//
+// The decorator is driven by the World & not safe for concurrent use, except for place. Writes
+// into an unloaded chunk are only kept, if the chunk is saved to a ChunkStore or cached.
+// A chunk, that is generated again, only receives the writes of loaded & pending origins.
+type Decorator struct {
+	seed     int64
+	features []Feature
+
+	// writes of loaded chunks
+	outputs map[ChunkPosition]*featureOutput
+	// writes of unloaded chunks into unloaded chunks
+	pending map[ChunkPosition]featureWrites
+}
+
+func NewDecorator(seed int64, features ...Feature) *Decorator {
+	return &Decorator{
+		seed:     seed,
+		features: features,
+		outputs:  make(map[ChunkPosition]*featureOutput),
+		pending:  make(map[ChunkPosition]featureWrites),
+	}
+}
+
+// place runs all features for the given chunk. It only reads the chunk & is called by the
+// world workers.
+func (d *Decorator) place(chunk *Chunk) map[ChunkPosition]featureWrites {
+	pos := chunk.Position
+	out := &FeatureWriter{origin: pos, writes: make(map[ChunkPosition]featureWrites)}
+	rnd := NewChunkRand(d.seed, pos.X, pos.Y, pos.Z)
+	for _, f := range d.features {
+		f.Place(chunk, rnd, out)
+	}
+	return out.writes
+}
+
+// decorate places the features of a freshly generated chunk. The blocks in the chunk itself are
+// written right away, the writes into the neighbors are returned. Like place, it is called by the
+// world workers.
+func (d *Decorator) decorate(chunk *Chunk) map[ChunkPosition]featureWrites {
+	writes := d.place(chunk)
+	if blocks, ok := writes[chunk.Position]; ok {
+		applyFeatureWrites(chunk, blocks)
+		delete(writes, chunk.Position)
+	}
+	return writes
+}
+
+// add applies the writes of a newly loaded chunk into its neighbors & all writes of other chunks
+// into it. Writes are nil, if the chunk was not generated freshly, otherwise they are the result
+// of decorate. Returns the indices of the changed blocks of the loaded chunks.
+func (d *Decorator) add(chunk *Chunk, writes map[ChunkPosition]featureWrites, chunks map[ChunkPosition]*Chunk) map[*Chunk][]int {
+	pos := chunk.Position
+	changed := make(map[*Chunk][]int)
+	apply := func(target *Chunk, blocks featureWrites) bool {
+		indices := applyFeatureWrites(target, blocks)
+		if len(indices) == 0 {
+			return false
+		}
+		target.modified = true
+		changed[target] = append(changed[target], indices...)
+		return true
+	}
+
+	// writes of other chunks
+	if pending, ok := d.pending[pos]; ok {
+		apply(chunk, pending)
+		delete(d.pending, pos)
+	}
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			for dz := -1; dz <= 1; dz++ {
+				output := d.outputs[ChunkPosition{pos.X + dx, pos.Y + dy, pos.Z + dz}]
+				if output == nil {
+					continue
+				}
+				// a fresh chunk lost the writes it received before it was unloaded
+				blocks, ok := output.writes[pos]
+				if ok && (writes != nil || !output.delivered[pos]) {
+					apply(chunk, blocks)
+					output.delivered[pos] = true
+				}
+			}
+		}
+	}
+
+	if len(writes) == 0 {
+		return changed
+	}
+
+	// writes into neighbors
+	output := &featureOutput{writes: writes, delivered: make(map[ChunkPosition]bool)}
+	d.outputs[pos] = output
+	for target, blocks := range writes {
+		neighbor := chunks[target]
+		if neighbor == nil {
+			continue
+		}
+		apply(neighbor, blocks)
+		output.delivered[target] = true
+	}
+	return changed
+}
+
+// remove is called after the chunk was unloaded. Its writes into chunks, that never received
+// them, are kept until these chunks are loaded.
+func (d *Decorator) remove(pos ChunkPosition) {
+	output, ok := d.outputs[pos]
+	if !ok {
+		return
+	}
+	delete(d.outputs, pos)
+	for target, blocks := range output.writes {
+		if output.delivered[target] {
+			continue
+		}
+		pending := d.pending[target]
+		if pending == nil {
+			pending = make(featureWrites)
+			d.pending[target] = pending
+		}
+		for index, block := range blocks {
+			mergeFeatureBlock(pending, index, block)
+		}
+	}
+}
+
+// applyFeatureWrites writes the blocks into air or over lower blocks of other features.
+// Returns the indices of the changed blocks.
+func applyFeatureWrites(chunk *Chunk, writes featureWrites) []int {
+	var changed []int
+	for index, block := range writes {
+		old := chunk.blocks.Get(index)
+		if old == block || (old.Active() && (!chunk.decorated[index] || old > block)) {
+			continue
+		}
+		if chunk.decorated == nil {
+			chunk.decorated = make(map[int]bool)
+		}
+		chunk.blocks.Set(index, block)
+		chunk.decorated[index] = true
+		changed = append(changed, index)
+	}
+	return changed
+}
+
+// ----------------------------------------------------------------------------
+
+// TreeFeature places trees with a trunk & a round crown of leaves on top of Ground blocks.
+type TreeFeature struct {
+	Ground uint16
+	Trunk  uint16
+	Leaves uint16
+	// number of attempts per chunk
+	Count int
+	// trunk height range & crown radius in blocks
+	MinHeight int
+	MaxHeight int
+	Radius    int
+}
+
+func (f *TreeFeature) Place(chunk *Chunk, rnd *rand.Rand, out *FeatureWriter) {
+	baseX := chunk.Position.X * ChunkWidth
+	baseY := chunk.Position.Y * ChunkHeight
+	baseZ := chunk.Position.Z * ChunkDepth
+
+	for i := 0; i < f.Count; i++ {
+		// always draw the same numbers, no matter if the tree is placed
+		x := rnd.Intn(ChunkWidth)
+		z := rnd.Intn(ChunkDepth)
+		height := f.MinHeight + rnd.Intn(f.MaxHeight-f.MinHeight+1)
+
+		// the ground has to be inside of this chunk, with air above
+		ground := -1
+		for y := ChunkHeight - 2; y >= 0; y-- {
+			if chunk.Get(x, y, z).Active() {
+				if !chunk.Get(x, y+1, z).Active() && chunk.Get(x, y, z).TypeID() == f.Ground {
+					ground = y
+				}
+				break
+			}
+		}
+		if ground < 0 {
+			continue
+		}
+
+		wx, wy, wz := baseX+x, baseY+ground+1, baseZ+z
+		trunk := Block(f.Trunk).Activate(true)
+		for y := 0; y < height; y++ {
+			out.Set(wx, wy+y, wz, trunk)
+		}
+
+		leaves := Block(f.Leaves).Activate(true)
+		top := wy + height - 1
+		for dy := -f.Radius; dy <= f.Radius; dy++ {
+			for dz := -f.Radius; dz <= f.Radius; dz++ {
+				for dx := -f.Radius; dx <= f.Radius; dx++ {
+					if dx*dx+dy*dy+dz*dz <= f.Radius*f.Radius {
+						out.Set(wx+dx, top+dy, wz+dz, leaves)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// hillGenerator generates bumpy ground of type 1 below y 9
+type hillGenerator struct{}
+
+func (g *hillGenerator) GenerateChunkAt(cx, cy, cz int, bank *BlockBank) *Chunk {
+	c := NewChunk(cx, cy, cz)
+	for z := 0; z < ChunkDepth; z++ {
+		for x := 0; x < ChunkWidth; x++ {
+			height := 4 + int(HashCoords(0, cx*ChunkWidth+x, 0, cz*ChunkDepth+z)%5)
+			for y := 0; y < ChunkHeight && cy*ChunkHeight+y < height; y++ {
+				c.Set(x, y, z, Block(1).Activate(true))
+			}
+		}
+	}
+	return c
+}
+
+func newDecoratedWorld(workers int) *World {
+	bank := newTestBank()
+	world := NewWorld(bank, &CulledMesher{}, NewGeneratorProvider(&hillGenerator{}, bank))
+	world.Workers = workers
+	// two kinds of trees, that overlap with each other
+	world.Decorator = NewDecorator(16726,
+		&TreeFeature{Ground: 1, Trunk: 2, Leaves: 3, Count: 4, MinHeight: 2, MaxHeight: 5, Radius: 3},
+		&TreeFeature{Ground: 1, Trunk: 3, Leaves: 2, Count: 4, MinHeight: 2, MaxHeight: 5, Radius: 2},
+	)
+	return world
+}
+
+func decorationPositions() []ChunkPosition {
+	positions := make([]ChunkPosition, 0)
+	for x := -2; x <= 2; x++ {
+		for z := -2; z <= 2; z++ {
+			positions = append(positions, ChunkPosition{x, 0, z})
+		}
+	}
+	return positions
+}
+
+// loadOneByOne loads the chunks in the given order, each one in its own update
+func loadOneByOne(world *World, positions []ChunkPosition) {
+	for _, pos := range positions {
+		world.GenerateNewChunk(pos.X, pos.Y, pos.Z)
+		world.processGenerating()
+	}
+}
+
+// innerHashes hashes the chunks, whose neighbors are all loaded
+func innerHashes(t *testing.T, world *World) map[ChunkPosition]uint64 {
+	hashes := make(map[ChunkPosition]uint64)
+	for x := -1; x <= 1; x++ {
+		for z := -1; z <= 1; z++ {
+			pos := ChunkPosition{x, 0, z}
+			chunk := world.allChunks[pos]
+			if chunk == nil {
+				t.Fatalf("chunk %v not loaded", pos.String())
+			}
+			hashes[pos] = chunkHash(chunk)
+		}
+	}
+	return hashes
+}
+
+func compareHashes(t *testing.T, name string, want, got map[ChunkPosition]uint64) {
+	for pos, hash := range want {
+		if got[pos] != hash {
+			t.Errorf("%v: chunk %v differs", name, pos.String())
+		}
+	}
+}
+
+func TestDecorationAcrossChunks(t *testing.T) {
+	world := newDecoratedWorld(0)
+	loadOneByOne(world, decorationPositions())
+
+	// some trees have to reach into neighbor chunks, otherwise the test is pointless
+	crossing := 0
+	for _, output := range world.Decorator.outputs {
+		for target := range output.writes {
+			if target.Y == 0 {
+				crossing++
+			}
+		}
+	}
+	if crossing == 0 {
+		t.Fatal("no feature crosses a chunk border")
+	}
+
+	// the leaves of trees in the neighbors are placed in the air
+	chunk := world.allChunks[ChunkPosition{0, 0, 0}]
+	for index := range chunk.decorated {
+		if !chunk.blocks.Get(index).Active() {
+			t.Error("decorated block is not active")
+		}
+	}
+	if len(chunk.decorated) == 0 {
+		t.Error("chunk has no decorations")
+	}
+}
+
+func TestDecorationLoadOrder(t *testing.T) {
+	world := newDecoratedWorld(0)
+	loadOneByOne(world, decorationPositions())
+	want := innerHashes(t, world)
+
+	// shuffled orders
+	for seed := int64(0); seed < 5; seed++ {
+		positions := decorationPositions()
+		shuffled := make([]ChunkPosition, len(positions))
+		for i, j := range rand.New(rand.NewSource(seed)).Perm(len(positions)) {
+			shuffled[i] = positions[j]
+		}
+		world := newDecoratedWorld(0)
+		loadOneByOne(world, shuffled)
+		compareHashes(t, "shuffled", want, innerHashes(t, world))
+	}
+
+	// all chunks in a single update
+	world = newDecoratedWorld(0)
+	for _, pos := range decorationPositions() {
+		world.GenerateNewChunk(pos.X, pos.Y, pos.Z)
+	}
+	world.processGenerating()
+	compareHashes(t, "batch", want, innerHashes(t, world))
+}
+
+func TestDecorationReload(t *testing.T) {
+	world := newDecoratedWorld(0)
+	loadOneByOne(world, decorationPositions())
+	want := innerHashes(t, world)
+
+	// unload a chunk & its neighbors in different orders, then load them again
+	unload := []ChunkPosition{{0, 0, 0}, {1, 0, 0}, {0, 0, -1}, {-1, 0, 1}}
+	for _, pos := range unload {
+		world.RemoveChunk(pos.X, pos.Y, pos.Z)
+	}
+	loadOneByOne(world, []ChunkPosition{{-1, 0, 1}, {0, 0, 0}, {0, 0, -1}, {1, 0, 0}})
+	compareHashes(t, "reload", want, innerHashes(t, world))
+
+	for i := len(unload) - 1; i >= 0; i-- {
+		world.RemoveChunk(unload[i].X, unload[i].Y, unload[i].Z)
+	}
+	loadOneByOne(world, unload)
+	compareHashes(t, "reload reversed", want, innerHashes(t, world))
+}
+
+func TestDecorationLight(t *testing.T) {
+	world := newDecoratedWorld(0)
+	positions := decorationPositions()
+	for i, j := range rand.New(rand.NewSource(3)).Perm(len(positions)) {
+		positions[i], positions[j] = positions[j], positions[i]
+	}
+	loadOneByOne(world, positions)
+
+	// the light, that was merged chunk by chunk & fixed after the features, is the same as the
+	// light of all chunks lit at once
+	lit := make(map[ChunkPosition]*Chunk)
+	engine := newLightEngine(world.bank)
+	for pos, chunk := range world.allChunks {
+		copied := &Chunk{Position: pos, blocks: chunk.blocks}
+		copied.setNeighbors(lit)
+		lit[pos] = copied
+		engine.addChunk(copied)
+	}
+	for pos, chunk := range world.allChunks {
+		for i := 0; i < ChunkXYZ; i++ {
+			x, y, z := i%ChunkWidth, i/ChunkXZ, i%ChunkXZ/ChunkWidth
+			if lightAt(chunk, x, y, z) != lightAt(lit[pos], x, y, z) {
+				t.Fatalf("light of chunk %v differs at %v, %v, %v", pos.String(), x, y, z)
+			}
+		}
+	}
+}
+
+func TestDecorationWorkers(t *testing.T) {
+	world := newDecoratedWorld(0)
+	loadOneByOne(world, decorationPositions())
+	want := innerHashes(t, world)
+
+	world = newDecoratedWorld(3)
+	defer world.Dispose()
+	for _, pos := range decorationPositions() {
+		world.GenerateNewChunk(pos.X, pos.Y, pos.Z)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for len(world.allChunks) < len(decorationPositions()) {
+		world.processGenerating()
+		world.meshingNeeded.clear()
+		if time.Now().After(deadline) {
+			t.Fatal("workers did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	compareHashes(t, "workers", want, innerHashes(t, world))
+}
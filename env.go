@@ -20,6 +20,7 @@ import (
 type SunLight struct {
 	Color     *Color
 	Direction *glm.Vector3
+	// Intensity scales the skylight, e.g. 0 for a dark night
 	Intensity float32
 }
 
@@ -13,12 +13,43 @@
 
 package vox
 
-import "math/rand"
-
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Generator generates the blocks of new chunks. The result must only depend on the seed of the
+// generator and the chunk coordinates, never on global state or the order in which chunks are
+// generated. Use NewChunkRand for randomness. GenerateChunkAt is called concurrently by the
+// world workers.
 type Generator interface {
 	GenerateChunkAt(x, y, z int, bank *BlockBank) *Chunk
 }
 
+// NewChunkRand returns a random number generator, that is seeded with a hash of the world seed
+// and the chunk coordinates. The same seed & coordinates always produce the same numbers.
+func NewChunkRand(seed int64, x, y, z int) *rand.Rand {
+	return rand.New(rand.NewSource(int64(HashCoords(seed, x, y, z))))
+}
+
+// HashCoords mixes the seed & the coordinates into a well distributed 64 bit hash.
+func HashCoords(seed int64, x, y, z int) uint64 {
+	h := mix64(uint64(seed))
+	h = mix64(h ^ uint64(int64(x)))
+	h = mix64(h ^ uint64(int64(y)))
+	h = mix64(h ^ uint64(int64(z)))
+	return h
+}
+
+// mix64 is the finalizer of splitmix64
+func mix64(h uint64) uint64 {
+	h += 0x9E3779B97F4A7C15
+	h = (h ^ (h >> 30)) * 0xBF58476D1CE4E5B9
+	h = (h ^ (h >> 27)) * 0x94D049BB133111EB
+	return h ^ (h >> 31)
+}
+
 type FlatGenerator struct {
 }
 
@@ -26,60 +57,92 @@ func (g *FlatGenerator) GenerateChunkAt(x, y, z int, bank *BlockBank) *Chunk {
 	c := NewChunk(x, y, z)
 
 	typeIdx := 0
-	for i := 0; i < ChunkXYZ; i++ {
-		c.Blocks[i] = c.Blocks[i].Activate(true)
-
-		// block type
-		if typeIdx >= len(bank.Types) {
-			typeIdx = 0
+	for y := 0; y < ChunkHeight; y++ {
+		for z := 0; z < ChunkDepth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				// block type
+				if typeIdx >= len(bank.Types) {
+					typeIdx = 0
+				}
+				block := Block(BlockNil).ChangeType(bank.Types[typeIdx]).Activate(true)
+				c.Set(x, y, z, block)
+				typeIdx++
+			}
 		}
-		c.Blocks[i] = c.Blocks[i].ChangeType(bank.Types[typeIdx])
-		typeIdx++
 	}
 
 	return c
 }
 
+// SimplexGenerator generates terrain from the registered biomes. Register biomes with
+// Biomes.Register before the world starts generating. It runs the terrain, surface, cave &
+// ore stages, use a PipelineGenerator for anything else.
 type SimplexGenerator struct {
-	seed  int64
-	noise *SimplexNoise
+	*Terrain
+
+	// Caves carves caves out of the terrain, if not nil
+	Caves *CaveCarver
+	// Ores are placed after the caves are carved
+	Ores []*Ore
+
+	seed int64
 }
 
-func NewSimplexGenerator(seed int64) Generator {
+func NewSimplexGenerator(seed int64) *SimplexGenerator {
 	return &SimplexGenerator{
-		seed:  seed,
-		noise: NewSimplex(seed),
+		Terrain: NewTerrain(seed),
+		seed:    seed,
 	}
 }
 
 func (g *SimplexGenerator) GenerateChunkAt(xx, yy, zz int, bank *BlockBank) *Chunk {
 	c := NewChunk(xx, yy, zz)
+	ctx := NewGenContext(c.Position, bank)
+
+	TerrainStage(g.Terrain).Run(c, ctx)
+	SurfaceStage().Run(c, ctx)
+	if g.Caves != nil {
+		CaveStage(g.Caves).Run(c, ctx)
+	}
+	if len(g.Ores) > 0 {
+		ctx.Rand = NewChunkRand(g.seed, xx, yy, zz)
+		OreStage(g.Ores...).Run(c, ctx)
+	}
 
-	t := uint8(1 + rand.Int()%3)
+	return c
+}
 
-	worldX := float64(xx)
-	worldZ := float64(zz)
-	scaleX := 1.0 / float64(ChunkWidth)
-	scaleZ := 1.0 / float64(ChunkDepth)
+// ----------------------------------------------------------------------------
 
-	typeIdx := 0
-	for z := 0; z < ChunkDepth; z++ {
-		for x := 0; x < ChunkWidth; x++ {
-			simplex := g.noise.Simplex2(worldX+float64(x)*scaleX, worldZ+float64(z)*scaleZ, 3, 0.5, 2)
-			height := int(simplex * ChunkHeight)
-			for y := 0; y < ChunkHeight; y++ {
-				i := c.IndexAt(x, y, z)
-				c.Blocks[i] = c.Blocks[i].Activate(y < height)
+// GeneratorFactory creates a generator with the given seed.
+type GeneratorFactory func(seed int64) Generator
 
-				// block type
-				if typeIdx >= len(bank.Types) {
-					typeIdx = 0
-				}
-				c.Blocks[i] = c.Blocks[i].ChangeType(bank.typeMap[t])
-				typeIdx++
-			}
-		}
+var generators = map[string]GeneratorFactory{
+	"flat":    func(seed int64) Generator { return &FlatGenerator{} },
+	"simplex": func(seed int64) Generator { return NewSimplexGenerator(seed) },
+}
+
+// RegisterGenerator makes a generator available by name, e.g. for the voxmap command. Call it
+// from an init function.
+func RegisterGenerator(name string, factory GeneratorFactory) {
+	generators[name] = factory
+}
+
+// NewGeneratorByName creates the registered generator with the given name.
+func NewGeneratorByName(name string, seed int64) (Generator, error) {
+	factory, ok := generators[name]
+	if !ok {
+		return nil, fmt.Errorf("vox: unknown generator %q", name)
 	}
+	return factory(seed), nil
+}
 
-	return c
+// GeneratorNames returns the names of all registered generators in alphabetical order.
+func GeneratorNames() []string {
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,380 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// GeneratorConfig describes a PipelineGenerator. Blocks maps the names, that are used by the
+// rest of the config, to block type ids. BlendWidth is the width of the biome transitions in
+// blocks & is optional. Stages is the order of the stages, by default terrain, surface, caves,
+// ores & decorations. Optional stages are skipped if not configured.
+type GeneratorConfig struct {
+	Seed       int64             `json:"seed"`
+	Blocks     map[string]uint16 `json:"blocks"`
+	Climate    NoiseConfig       `json:"climate"`
+	BlendWidth float64           `json:"blendWidth"`
+	Biomes     []BiomeConfig     `json:"biomes"`
+	Caves      *CaveConfig       `json:"caves"`
+	Ores       []OreConfig       `json:"ores"`
+	Trees      []TreeConfig      `json:"trees"`
+	Stages     []string          `json:"stages"`
+}
+
+// NoiseConfig are the parameters of a fractal noise layer. Scale is the frequency per block.
+// Persistence defaults to 0.5 and Lacunarity to 2.
+type NoiseConfig struct {
+	Octaves     int     `json:"octaves"`
+	Persistence float64 `json:"persistence"`
+	Lacunarity  float64 `json:"lacunarity"`
+	Scale       float64 `json:"scale"`
+}
+
+type BiomeConfig struct {
+	Name        string      `json:"name"`
+	Temperature float64     `json:"temperature"`
+	Humidity    float64     `json:"humidity"`
+	Surface     string      `json:"surface"`
+	Filler      string      `json:"filler"`
+	BaseHeight  float64     `json:"baseHeight"`
+	HeightScale float64     `json:"heightScale"`
+	Noise       NoiseConfig `json:"noise"`
+}
+
+// CaveConfig configures the cave stage. Mode is "worm" or "cheese", MinY & MaxY are optional.
+type CaveConfig struct {
+	Mode      string      `json:"mode"`
+	Threshold float64     `json:"threshold"`
+	MinY      *int        `json:"minY"`
+	MaxY      *int        `json:"maxY"`
+	Noise     NoiseConfig `json:"noise"`
+}
+
+type OreConfig struct {
+	Block   string `json:"block"`
+	Replace string `json:"replace"`
+	Count   int    `json:"count"`
+	Size    int    `json:"size"`
+	MinY    int    `json:"minY"`
+	MaxY    int    `json:"maxY"`
+}
+
+type TreeConfig struct {
+	Ground    string `json:"ground"`
+	Trunk     string `json:"trunk"`
+	Leaves    string `json:"leaves"`
+	Count     int    `json:"count"`
+	MinHeight int    `json:"minHeight"`
+	MaxHeight int    `json:"maxHeight"`
+	Radius    int    `json:"radius"`
+}
+
+// ConfigError lists all problems of an invalid config.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "vox: invalid generator config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *ConfigError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// LoadGeneratorConfig reads & validates the config at the given path.
+func LoadGeneratorConfig(path string) (*GeneratorConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGeneratorConfig(data)
+}
+
+// ParseGeneratorConfig parses & validates the config. Unknown fields are an error, so typos
+// don't go unnoticed.
+func ParseGeneratorConfig(data []byte) (*GeneratorConfig, error) {
+	config := &GeneratorConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("vox: failed to parse generator config: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks the whole config & reports all problems at once.
+func (c *GeneratorConfig) Validate() error {
+	e := &ConfigError{}
+
+	if len(c.Blocks) == 0 {
+		e.add("blocks: at least one block is needed")
+	}
+	for name, id := range c.Blocks {
+		if id == BlockNil || id > blockTypeMask {
+			e.add("blocks: %q has the invalid id %v", name, id)
+		}
+	}
+	block := func(context, field, name string) {
+		if _, ok := c.Blocks[name]; !ok {
+			e.add("%v: %v: unknown block %q", context, field, name)
+		}
+	}
+
+	c.Climate.validate(e, "climate")
+	if c.BlendWidth < 0 {
+		e.add("blendWidth must not be negative")
+	}
+
+	if len(c.Biomes) == 0 {
+		e.add("biomes: at least one biome is needed")
+	}
+	names := make(map[string]bool)
+	for i, b := range c.Biomes {
+		context := fmt.Sprintf("biomes[%v]", i)
+		if b.Name == "" {
+			e.add("%v: name is missing", context)
+		} else if names[b.Name] {
+			e.add("%v: name %q is used twice", context, b.Name)
+		} else {
+			context = fmt.Sprintf("biome %q", b.Name)
+		}
+		names[b.Name] = true
+		if b.Temperature < 0 || b.Temperature > 1 {
+			e.add("%v: temperature must be in [0, 1]", context)
+		}
+		if b.Humidity < 0 || b.Humidity > 1 {
+			e.add("%v: humidity must be in [0, 1]", context)
+		}
+		if b.HeightScale < 0 {
+			e.add("%v: heightScale must not be negative", context)
+		}
+		block(context, "surface", b.Surface)
+		block(context, "filler", b.Filler)
+		b.Noise.validate(e, context+": noise")
+	}
+
+	if c.Caves != nil {
+		if c.Caves.Mode != "worm" && c.Caves.Mode != "cheese" {
+			e.add("caves: mode must be \"worm\" or \"cheese\", not %q", c.Caves.Mode)
+		}
+		if c.Caves.Threshold <= 0 {
+			e.add("caves: threshold must be positive")
+		}
+		if c.Caves.MinY != nil && c.Caves.MaxY != nil && *c.Caves.MinY >= *c.Caves.MaxY {
+			e.add("caves: minY must be below maxY")
+		}
+		c.Caves.Noise.validate(e, "caves: noise")
+	}
+
+	for i, o := range c.Ores {
+		context := fmt.Sprintf("ores[%v]", i)
+		block(context, "block", o.Block)
+		block(context, "replace", o.Replace)
+		if o.Count < 0 {
+			e.add("%v: count must not be negative", context)
+		}
+		if o.Size < 0 {
+			e.add("%v: size must not be negative", context)
+		}
+		if o.MinY >= o.MaxY {
+			e.add("%v: minY must be below maxY", context)
+		}
+	}
+
+	for i, t := range c.Trees {
+		context := fmt.Sprintf("trees[%v]", i)
+		block(context, "ground", t.Ground)
+		block(context, "trunk", t.Trunk)
+		block(context, "leaves", t.Leaves)
+		if t.Count < 0 {
+			e.add("%v: count must not be negative", context)
+		}
+		if t.MinHeight < 1 || t.MaxHeight < t.MinHeight {
+			e.add("%v: heights must be 1 <= minHeight <= maxHeight", context)
+		}
+		if t.Radius < 0 {
+			e.add("%v: radius must not be negative", context)
+		}
+	}
+
+	stages := make(map[string]bool)
+	for _, stage := range c.Stages {
+		switch stage {
+		case StageTerrain, StageSurface, StageCaves, StageOres, StageDecorations:
+		default:
+			e.add("stages: unknown stage %q", stage)
+		}
+		if stages[stage] {
+			e.add("stages: %q is used twice", stage)
+		}
+		stages[stage] = true
+	}
+
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func (n *NoiseConfig) validate(e *ConfigError, context string) {
+	if n.Octaves < 1 {
+		e.add("%v: octaves must be at least 1", context)
+	}
+	if n.Scale <= 0 {
+		e.add("%v: scale must be positive", context)
+	}
+	if n.Persistence < 0 || n.Lacunarity < 0 {
+		e.add("%v: persistence & lacunarity must not be negative", context)
+	}
+}
+
+func (n *NoiseConfig) persistence() float64 {
+	if n.Persistence == 0 {
+		return 0.5
+	}
+	return n.Persistence
+}
+
+func (n *NoiseConfig) lacunarity() float64 {
+	if n.Lacunarity == 0 {
+		return 2
+	}
+	return n.Lacunarity
+}
+
+// BuildTerrain creates the terrain with the configured biomes. The config has to be valid.
+func (c *GeneratorConfig) BuildTerrain() *Terrain {
+	terrain := NewTerrain(c.Seed)
+	terrain.ClimateScale = c.Climate.Scale
+	terrain.ClimateOctaves = c.Climate.Octaves
+	if c.BlendWidth > 0 {
+		terrain.BlendWidth = c.BlendWidth
+	}
+	for _, b := range c.Biomes {
+		terrain.Biomes.Register(&Biome{
+			Name:        b.Name,
+			Temperature: b.Temperature,
+			Humidity:    b.Humidity,
+			Surface:     c.Blocks[b.Surface],
+			Filler:      c.Blocks[b.Filler],
+			BaseHeight:  b.BaseHeight,
+			HeightScale: b.HeightScale,
+			Octaves:     b.Noise.Octaves,
+			Persistence: b.Noise.persistence(),
+			Lacunarity:  b.Noise.lacunarity(),
+			Scale:       b.Noise.Scale,
+		})
+	}
+	return terrain
+}
+
+// NewGenerator instantiates the generator. If trees are configured, the returned decorator
+// has to be set on the World as well, otherwise it is nil. If the bank is not nil, all block
+// ids have to be types of the bank.
+func (c *GeneratorConfig) NewGenerator(bank *BlockBank) (*PipelineGenerator, *Decorator, error) {
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if bank != nil {
+		e := &ConfigError{}
+		for name, id := range c.Blocks {
+			if bank.TypeOf(Block(id)) == nil {
+				e.add("blocks: %q has the id %v, which is not in the block bank", name, id)
+			}
+		}
+		if len(e.Problems) > 0 {
+			return nil, nil, e
+		}
+	}
+
+	terrain := c.BuildTerrain()
+
+	available := map[string]Stage{
+		StageTerrain: TerrainStage(terrain),
+		StageSurface: SurfaceStage(),
+	}
+
+	if c.Caves != nil {
+		mode := CaveWorm
+		if c.Caves.Mode == "cheese" {
+			mode = CaveCheese
+		}
+		carver := NewCaveCarver(c.Seed, mode)
+		carver.Threshold = c.Caves.Threshold
+		carver.Scale = c.Caves.Noise.Scale
+		carver.Octaves = c.Caves.Noise.Octaves
+		carver.Persistence = c.Caves.Noise.persistence()
+		carver.Lacunarity = c.Caves.Noise.lacunarity()
+		if c.Caves.MinY != nil {
+			carver.MinY = *c.Caves.MinY
+		}
+		if c.Caves.MaxY != nil {
+			carver.MaxY = *c.Caves.MaxY
+		}
+		available[StageCaves] = CaveStage(carver)
+	}
+
+	ores := make([]*Ore, 0)
+	for _, o := range c.Ores {
+		ores = append(ores, &Ore{
+			Block:   c.Blocks[o.Block],
+			Replace: c.Blocks[o.Replace],
+			Count:   o.Count,
+			Size:    o.Size,
+			MinY:    o.MinY,
+			MaxY:    o.MaxY,
+		})
+	}
+	available[StageOres] = OreStage(ores...)
+
+	var decorator *Decorator
+	if len(c.Trees) > 0 {
+		features := make([]Feature, 0)
+		for _, t := range c.Trees {
+			features = append(features, &TreeFeature{
+				Ground:    c.Blocks[t.Ground],
+				Trunk:     c.Blocks[t.Trunk],
+				Leaves:    c.Blocks[t.Leaves],
+				Count:     t.Count,
+				MinHeight: t.MinHeight,
+				MaxHeight: t.MaxHeight,
+				Radius:    t.Radius,
+			})
+		}
+		decorator = NewDecorator(c.Seed, features...)
+		available[StageDecorations] = DecorationStage(decorator)
+	}
+
+	order := c.Stages
+	if len(order) == 0 {
+		order = []string{StageTerrain, StageSurface, StageCaves, StageOres, StageDecorations}
+	}
+	generator := NewPipelineGenerator(c.Seed)
+	for _, name := range order {
+		if stage, ok := available[name]; ok {
+			generator.Add(stage)
+		}
+	}
+
+	return generator, decorator, nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"strings"
+	"testing"
+)
+
+const testGeneratorConfig = `{
+	"seed": 7,
+	"blocks": {"stone": 1, "grass": 2, "ore": 3},
+	"climate": {"octaves": 2, "scale": 0.015},
+	"biomes": [
+		{"name": "low", "temperature": 0.2, "humidity": 0.5, "surface": "grass", "filler": "stone",
+			"baseHeight": 2, "heightScale": 8, "noise": {"octaves": 2, "scale": 0.03}},
+		{"name": "high", "temperature": 0.8, "humidity": 0.5, "surface": "ore", "filler": "ore",
+			"baseHeight": 16, "heightScale": 24, "noise": {"octaves": 3, "persistence": 0.5, "lacunarity": 2, "scale": 0.03}}
+	],
+	"caves": {"mode": "cheese", "threshold": 0.6, "minY": -32, "noise": {"octaves": 2, "scale": 0.1}},
+	"ores": [{"block": "ore", "replace": "stone", "count": 20, "minY": -100, "maxY": 100}],
+	"trees": [{"ground": "grass", "trunk": "stone", "leaves": "grass", "count": 2, "minHeight": 2, "maxHeight": 4, "radius": 1}]
+}`
+
+func TestGeneratorConfig(t *testing.T) {
+	config, err := ParseGeneratorConfig([]byte(testGeneratorConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, decorator, err := config.NewGenerator(newTestBank())
+	if err != nil || decorator == nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0)
+	for _, s := range gen.Stages() {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "terrain,surface,caves,ores,decorations" {
+		t.Error(names)
+	}
+
+	// the same generator built by hand
+	terrain := NewTerrain(7)
+	terrain.ClimateScale = 0.015
+	terrain.Biomes.Register(&Biome{Name: "low", Temperature: 0.2, Humidity: 0.5, Surface: 2, Filler: 1,
+		BaseHeight: 2, HeightScale: 8, Octaves: 2, Persistence: 0.5, Lacunarity: 2, Scale: 0.03})
+	terrain.Biomes.Register(&Biome{Name: "high", Temperature: 0.8, Humidity: 0.5, Surface: 3, Filler: 3,
+		BaseHeight: 16, HeightScale: 24, Octaves: 3, Persistence: 0.5, Lacunarity: 2, Scale: 0.03})
+	carver := NewCaveCarver(7, CaveCheese)
+	carver.Threshold = 0.6
+	carver.Scale = 0.1
+	carver.MinY = -32
+	trees := NewDecorator(7, &TreeFeature{Ground: 2, Trunk: 1, Leaves: 2, Count: 2, MinHeight: 2, MaxHeight: 4, Radius: 1})
+	expected := NewPipelineGenerator(7, TerrainStage(terrain), SurfaceStage(), CaveStage(carver),
+		OreStage(&Ore{Block: 3, Replace: 1, Count: 20, MinY: -100, MaxY: 100}), DecorationStage(trees))
+
+	for _, pos := range testPositions(1) {
+		a := gen.GenerateChunkAt(pos.X, pos.Y, pos.Z, nil)
+		b := expected.GenerateChunkAt(pos.X, pos.Y, pos.Z, nil)
+		if chunkHash(a) != chunkHash(b) {
+			t.Errorf("chunk %v differs", pos.String())
+		}
+	}
+}
+
+func TestGeneratorConfigBlockBank(t *testing.T) {
+	config, _ := ParseGeneratorConfig([]byte(testGeneratorConfig))
+	bank := NewBlockBank()
+	bank.AddType(&BlockType{ID: 1})
+	bank.AddType(&BlockType{ID: 2})
+	_, _, err := config.NewGenerator(bank)
+	if err == nil || !strings.Contains(err.Error(), `"ore" has the id 3, which is not in the block bank`) {
+		t.Error(err)
+	}
+}
+
+func TestGeneratorConfigStages(t *testing.T) {
+	config, _ := ParseGeneratorConfig([]byte(testGeneratorConfig))
+	config.Stages = []string{"terrain", "ores"}
+	gen, _, err := config.NewGenerator(nil)
+	if err != nil || len(gen.Stages()) != 2 || gen.Stages()[1].Name != StageOres {
+		t.Error(err)
+	}
+
+	config.Stages = []string{"terrain", "terrain", "weather"}
+	_, _, err = config.NewGenerator(nil)
+	if err == nil || len(err.(*ConfigError).Problems) != 2 {
+		t.Error(err)
+	}
+}
+
+func TestGeneratorConfigErrors(t *testing.T) {
+	_, err := ParseGeneratorConfig([]byte(`{"seed": 1, "biomez": []}`))
+	if err == nil || !strings.Contains(err.Error(), "biomez") {
+		t.Error(err)
+	}
+
+	invalid := `{
+		"blocks": {"stone": 1, "air": 0},
+		"climate": {"octaves": 1, "scale": 0.01},
+		"blendWidth": -4,
+		"biomes": [
+			{"name": "a", "temperature": 2, "humidity": 0.5, "surface": "grass", "filler": "stone", "noise": {"octaves": 1, "scale": 0.1}},
+			{"name": "a", "surface": "stone", "filler": "stone", "noise": {"octaves": 0, "scale": 0.1}}
+		],
+		"caves": {"mode": "spaghetti", "threshold": 0.5, "noise": {"octaves": 1, "scale": 0.1}},
+		"ores": [{"block": "gold", "replace": "stone", "count": 1, "minY": 5, "maxY": 5}]
+	}`
+	_, err = ParseGeneratorConfig([]byte(invalid))
+	if err == nil {
+		t.Fatal("invalid config was accepted")
+	}
+	expected := []string{
+		`blocks: "air" has the invalid id 0`,
+		`blendWidth must not be negative`,
+		`biome "a": temperature must be in [0, 1]`,
+		`biome "a": surface: unknown block "grass"`,
+		`biomes[1]: name "a" is used twice`,
+		`biomes[1]: noise: octaves must be at least 1`,
+		`caves: mode must be "worm" or "cheese", not "spaghetti"`,
+		`ores[0]: block: unknown block "gold"`,
+		`ores[0]: minY must be below maxY`,
+	}
+	problems := err.(*ConfigError).Problems
+	if len(problems) != len(expected) {
+		t.Error(err)
+	}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Errorf("missing problem: %v", e)
+		}
+	}
+}
+
+func TestSandboxGeneratorConfig(t *testing.T) {
+	config, err := LoadGeneratorConfig("sandbox/assets/worldgen.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := config.NewGenerator(nil); err != nil {
+		t.Error(err)
+	}
+}
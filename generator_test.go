@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"testing"
+)
+
+// chunkHash hashes all blocks of the chunk
+func chunkHash(chunk *Chunk) uint64 {
+	h := fnv.New64a()
+	for i := 0; i < ChunkXYZ; i++ {
+		b := chunk.blocks.Get(i)
+		h.Write([]byte{byte(b), byte(b >> 8), byte(b >> 16), byte(b >> 24)})
+	}
+	return h.Sum64()
+}
+
+// testPositions returns a cube of chunk positions around the origin
+func testPositions(radius int) []ChunkPosition {
+	positions := make([]ChunkPosition, 0)
+	for x := -radius; x <= radius; x++ {
+		for y := -1; y <= 1; y++ {
+			for z := -radius; z <= radius; z++ {
+				positions = append(positions, ChunkPosition{x, y, z})
+			}
+		}
+	}
+	return positions
+}
+
+// checkDeterministic generates the same chunks with two generators created by newGenerator,
+// once in order & once shuffled, and fails if any chunk differs.
+func checkDeterministic(t *testing.T, newGenerator func() Generator) {
+	bank := newTestBank()
+	positions := testPositions(3)
+
+	first := make(map[ChunkPosition]uint64)
+	gen := newGenerator()
+	for _, pos := range positions {
+		first[pos] = chunkHash(gen.GenerateChunkAt(pos.X, pos.Y, pos.Z, bank))
+	}
+
+	// disturb the global random generator, a new run would have a different state
+	rand.Seed(12345)
+	rand.Int()
+
+	gen = newGenerator()
+	rnd := rand.New(rand.NewSource(99))
+	for _, i := range rnd.Perm(len(positions)) {
+		pos := positions[i]
+		chunk := gen.GenerateChunkAt(pos.X, pos.Y, pos.Z, bank)
+		if chunk.Position != pos {
+			t.Fatalf("chunk %v has position %v", pos.String(), chunk.Position.String())
+		}
+		if chunkHash(chunk) != first[pos] {
+			t.Fatalf("chunk %v differs between runs", pos.String())
+		}
+	}
+}
+
+func TestChunkRand(t *testing.T) {
+	a := NewChunkRand(1, 2, 3, 4).Int63()
+	if a != NewChunkRand(1, 2, 3, 4).Int63() {
+		t.Error()
+	}
+	if a == NewChunkRand(2, 2, 3, 4).Int63() || a == NewChunkRand(1, 3, 2, 4).Int63() || a == NewChunkRand(1, 2, 3, -4).Int63() {
+		t.Error()
+	}
+}
+
+func TestFlatGeneratorDeterministic(t *testing.T) {
+	checkDeterministic(t, func() Generator { return &FlatGenerator{} })
+}
+
+func TestSimplexGeneratorDeterministic(t *testing.T) {
+	checkDeterministic(t, func() Generator { return NewSimplexGenerator(16726) })
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build headless
+// +build headless
+
+package vox
+
+// Built with the headless tag, the package doesn't link OpenGL & GLFW. There is no window &
+// the meshes of the World are never uploaded, but generating, lighting & meshing chunks works.
+
+func NewMesh() *Mesh {
+	return &Mesh{}
+}
+
+// Load only keeps the index counts of the mesh data.
+func (m *Mesh) Load(data *MeshData) {
+	m.IndexCount = int32(data.IndexCount)
+	for i, count := range data.LayerIndexCounts {
+		m.LayerIndexCounts[i] = int32(count)
+	}
+}
+
+func (m *Mesh) Dispose() {
+}
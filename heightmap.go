@@ -0,0 +1,195 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+)
+
+// EdgeMode defines the terrain outside of a heightmap.
+type EdgeMode int
+
+const (
+	// EdgeClamp repeats the border pixels of the image
+	EdgeClamp EdgeMode = iota
+	// EdgeTile repeats the whole image
+	EdgeTile
+	// EdgeVoid leaves everything outside of the image empty, for bounded worlds
+	EdgeVoid
+)
+
+// HeightmapGenerator builds terrain from a grayscale image, one pixel per block column. The
+// column height is BaseHeight + gray * VerticalScale, with gray from 0 (black) to 1 (white).
+// Columns are filled with the Filler block & topped with the Surface block or the block of the
+// splat map.
+type HeightmapGenerator struct {
+	VerticalScale float64
+	BaseHeight    int
+	Edge          EdgeMode
+	// world x & z of the top left pixel. By default the image is centered around the origin.
+	OriginX int
+	OriginZ int
+
+	Surface uint16
+	Filler  uint16
+
+	// the gray values of the heightmap pixels, from the top row to the bottom row
+	heights     []uint16
+	width       int
+	height      int
+	splat       *Pixmap
+	splatColors map[uint32]uint16
+}
+
+var errEmptyHeightmap = errors.New("vox: empty heightmap image")
+
+// NewHeightmapGenerator creates a generator from an 8 bit image. The gray value of a pixel is
+// the average of its color channels. Returns an error if the image has no pixels.
+func NewHeightmapGenerator(heightmap *Pixmap) (*HeightmapGenerator, error) {
+	width, height := int(heightmap.Width), int(heightmap.Height)
+	if width <= 0 || height <= 0 {
+		return nil, errEmptyHeightmap
+	}
+	heights := make([]uint16, 0, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b := heightmap.RGB(x, y)
+			gray := (float64(r) + float64(g) + float64(b)) / 3
+			heights = append(heights, uint16(gray*0x101+0.5))
+		}
+	}
+	return newHeightmapGenerator(heights, width, height), nil
+}
+
+// NewHeightmapGeneratorFromImage creates a generator from an image. 16 bit grayscale images
+// keep their full precision. Returns an error if the image has no pixels.
+func NewHeightmapGeneratorFromImage(img image.Image) (*HeightmapGenerator, error) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errEmptyHeightmap
+	}
+	heights := make([]uint16, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			heights = append(heights, color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y)
+		}
+	}
+	return newHeightmapGenerator(heights, bounds.Dx(), bounds.Dy()), nil
+}
+
+func newHeightmapGenerator(heights []uint16, width, height int) *HeightmapGenerator {
+	return &HeightmapGenerator{
+		VerticalScale: 64,
+		OriginX:       -width / 2,
+		OriginZ:       -height / 2,
+		Surface:       1,
+		Filler:        1,
+		heights:       heights,
+		width:         width,
+		height:        height,
+	}
+}
+
+// SetSplatMap sets an image, that picks the surface block of every column. Colors are 0xRRGGBB
+// & map to block type ids. Pixels use the closest color of the mapping. The splat map is
+// stretched over the heightmap, if the sizes differ.
+func (g *HeightmapGenerator) SetSplatMap(splat *Pixmap, colors map[uint32]uint16) {
+	g.splat = splat
+	g.splatColors = colors
+}
+
+// pixel maps the world column to a heightmap pixel. Returns false if the column is empty.
+func (g *HeightmapGenerator) pixel(x, z int) (int, int, bool) {
+	px, pz := x-g.OriginX, z-g.OriginZ
+	w, h := g.width, g.height
+	switch g.Edge {
+	case EdgeTile:
+		px, pz = px-FloorDiv(px, w)*w, pz-FloorDiv(pz, h)*h
+	case EdgeVoid:
+		if px < 0 || pz < 0 || px >= w || pz >= h {
+			return 0, 0, false
+		}
+	default:
+		px, pz = clampInt(px, 0, w-1), clampInt(pz, 0, h-1)
+	}
+	return px, pz, true
+}
+
+// HeightAt returns the world y of the first air block above the terrain at the given column
+// or math.MinInt32 outside of a bounded heightmap.
+func (g *HeightmapGenerator) HeightAt(x, z int) int {
+	px, pz, ok := g.pixel(x, z)
+	if !ok {
+		return math.MinInt32
+	}
+	gray := float64(g.heights[px+pz*g.width]) / 0xFFFF
+	return g.BaseHeight + int(gray*g.VerticalScale+0.5)
+}
+
+// surfaceAt returns the surface block type of the column at the heightmap pixel
+func (g *HeightmapGenerator) surfaceAt(px, pz int) uint16 {
+	if g.splat == nil || len(g.splatColors) == 0 {
+		return g.Surface
+	}
+
+	sx := px * int(g.splat.Width) / g.width
+	sz := pz * int(g.splat.Height) / g.height
+	r, gr, b := g.splat.RGB(sx, sz)
+
+	best, bestDist := g.Surface, -1
+	for color, block := range g.splatColors {
+		dr := int(r) - int(color>>16&0xFF)
+		dg := int(gr) - int(color>>8&0xFF)
+		db := int(b) - int(color&0xFF)
+		dist := dr*dr + dg*dg + db*db
+		// ties are broken by the block type id, so the map order doesn't matter
+		if bestDist < 0 || dist < bestDist || (dist == bestDist && block < best) {
+			best, bestDist = block, dist
+		}
+	}
+	return best
+}
+
+func (g *HeightmapGenerator) GenerateChunkAt(xx, yy, zz int, bank *BlockBank) *Chunk {
+	c := NewChunk(xx, yy, zz)
+	baseY := yy * ChunkHeight
+
+	for z := 0; z < ChunkDepth; z++ {
+		for x := 0; x < ChunkWidth; x++ {
+			px, pz, ok := g.pixel(xx*ChunkWidth+x, zz*ChunkDepth+z)
+			if !ok {
+				continue
+			}
+			height := g.HeightAt(xx*ChunkWidth+x, zz*ChunkDepth+z)
+			if height <= baseY {
+				continue
+			}
+
+			surface := Block(g.surfaceAt(px, pz)).Activate(true)
+			filler := Block(g.Filler).Activate(true)
+			for y := 0; y < ChunkHeight && baseY+y < height; y++ {
+				if baseY+y == height-1 {
+					c.Set(x, y, z, surface)
+				} else {
+					c.Set(x, y, z, filler)
+				}
+			}
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// newTestHeightmap returns a 4x2 heightmap with the gray values 0, 51, 102, ... & 255
+func newTestHeightmap() *Pixmap {
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	for i := 0; i < 8; i++ {
+		img.SetGray(i%4, i/4, color.Gray{uint8(i * 255 / 7)})
+	}
+	return NewPixmapFromImage(img)
+}
+
+// newTestHeightmapGenerator returns a generator for the test heightmap
+func newTestHeightmapGenerator() *HeightmapGenerator {
+	gen, err := NewHeightmapGenerator(newTestHeightmap())
+	if err != nil {
+		panic(err)
+	}
+	return gen
+}
+
+func TestPixmapFromImage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(1, 0, color.RGBA{10, 20, 30, 255})
+	img.Set(0, 1, color.NRGBA{200, 100, 50, 128})
+	pixmap := NewPixmapFromImage(img)
+	if pixmap.Width != 2 || pixmap.Height != 2 || len(pixmap.Data) != 16 {
+		t.Fatal()
+	}
+	if r, g, b := pixmap.RGB(1, 0); r != 10 || g != 20 || b != 30 {
+		t.Error(r, g, b)
+	}
+	// opengl order, the top row is last
+	if pixmap.Data[12] != 10 {
+		t.Error()
+	}
+
+	// alpha is kept & the colors are not premultiplied
+	if r, g, b, a := pixmap.RGBA(0, 1); r != 200 || g != 100 || b != 50 || a != 128 {
+		t.Error(r, g, b, a)
+	}
+	if _, _, _, a := pixmap.RGBA(0, 0); a != 0 {
+		t.Error(a)
+	}
+}
+
+func TestHeightmapEdges(t *testing.T) {
+	gen := newTestHeightmapGenerator()
+	gen.VerticalScale = 7
+	gen.BaseHeight = 1
+	gen.OriginX, gen.OriginZ = 0, 0
+
+	if gen.HeightAt(0, 0) != 1 || gen.HeightAt(3, 0) != 4 || gen.HeightAt(3, 1) != 8 {
+		t.Error(gen.HeightAt(0, 0), gen.HeightAt(3, 0), gen.HeightAt(3, 1))
+	}
+
+	// clamped
+	if gen.HeightAt(-5, -5) != 1 || gen.HeightAt(100, 100) != 8 || gen.HeightAt(1, 9) != 6 {
+		t.Error()
+	}
+
+	gen.Edge = EdgeTile
+	if gen.HeightAt(4, 0) != 1 || gen.HeightAt(-1, -1) != 8 || gen.HeightAt(9, 2) != 2 {
+		t.Error(gen.HeightAt(4, 0), gen.HeightAt(-1, -1), gen.HeightAt(9, 2))
+	}
+
+	gen.Edge = EdgeVoid
+	if gen.HeightAt(4, 0) != math.MinInt32 || gen.HeightAt(2, 1) != 7 {
+		t.Error()
+	}
+	c := gen.GenerateChunkAt(-1, -1, 0, nil)
+	for i := 0; i < ChunkXYZ; i++ {
+		if c.blocks.Get(i).Active() {
+			t.Fatal("block outside of a bounded heightmap")
+		}
+	}
+}
+
+func TestHeightmapChunks(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetGray(x, y, color.Gray{uint8(x * 8)})
+		}
+	}
+	gen, err := NewHeightmapGenerator(NewPixmapFromImage(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.VerticalScale = 255.0 / 8
+	gen.Surface, gen.Filler = 2, 1
+
+	// columns span multiple chunk layers, with the surface block on top
+	for _, pos := range testPositions(1) {
+		c := gen.GenerateChunkAt(pos.X, pos.Y, pos.Z, nil)
+		for z := 0; z < ChunkDepth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				height := gen.HeightAt(pos.X*ChunkWidth+x, pos.Z*ChunkDepth+z)
+				for y := 0; y < ChunkHeight; y++ {
+					wy := pos.Y*ChunkHeight + y
+					block := c.Get(x, y, z)
+					if block.Active() != (wy < height) {
+						t.Fatalf("wrong block at %v,%v,%v", x, wy, z)
+					}
+					if wy == height-1 && block.TypeID() != 2 || wy < height-1 && block.TypeID() != 1 {
+						t.Fatalf("wrong type at %v,%v,%v", x, wy, z)
+					}
+				}
+			}
+		}
+	}
+	checkDeterministic(t, func() Generator { return gen })
+}
+
+func TestHeightmapSplat(t *testing.T) {
+	// the splat map has half the size of the heightmap
+	splat := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	splat.Set(0, 0, color.RGBA{250, 5, 0, 255})
+	splat.Set(1, 0, color.RGBA{0, 0, 200, 255})
+
+	gen := newTestHeightmapGenerator()
+	gen.VerticalScale = 7
+	gen.OriginX, gen.OriginZ = 0, 0
+	gen.SetSplatMap(NewPixmapFromImage(splat), map[uint32]uint16{0xFF0000: 2, 0x0000FF: 3})
+
+	c := gen.GenerateChunkAt(0, 0, 0, nil)
+	for x := 0; x < 4; x++ {
+		height := gen.HeightAt(x, 1)
+		want := uint16(2)
+		if x >= 2 {
+			want = 3
+		}
+		if top := c.Get(x, height-1, 1); top.TypeID() != want {
+			t.Errorf("surface at %v is %v", x, top.TypeID())
+		}
+	}
+}
+
+func TestHeightmapSplatTie(t *testing.T) {
+	splat := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	splat.Set(0, 0, color.RGBA{100, 0, 100, 255})
+
+	// the pixel is as close to red as to blue, the lower block type id wins
+	gen := newTestHeightmapGenerator()
+	for i := 0; i < 10; i++ {
+		gen.SetSplatMap(NewPixmapFromImage(splat), map[uint32]uint16{0xC80000: 5, 0x0000C8: 4})
+		if block := gen.surfaceAt(0, 0); block != 4 {
+			t.Fatal(block)
+		}
+	}
+}
+
+func TestHeightmap16Bit(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 3, 1))
+	img.SetGray16(0, 0, color.Gray16{0x1000})
+	img.SetGray16(1, 0, color.Gray16{0x1080})
+	img.SetGray16(2, 0, color.Gray16{0xFFFF})
+
+	// both pixels have the same 8 bit gray value
+	gen, err := NewHeightmapGeneratorFromImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.VerticalScale = 0xFFFF
+	gen.OriginX, gen.OriginZ = 0, 0
+	if h := [3]int{gen.HeightAt(0, 0), gen.HeightAt(1, 0), gen.HeightAt(2, 0)}; h != [3]int{0x1000, 0x1080, 0xFFFF} {
+		t.Error(h)
+	}
+
+	// 8 bit images get the same heights with both constructors
+	pixmap := newTestHeightmap()
+	gray := image.NewGray(image.Rect(0, 0, 4, 2))
+	for i := 0; i < 8; i++ {
+		gray.SetGray(i%4, i/4, color.Gray{uint8(i * 255 / 7)})
+	}
+	a, _ := NewHeightmapGenerator(pixmap)
+	b, _ := NewHeightmapGeneratorFromImage(gray)
+	for x := -2; x < 2; x++ {
+		for z := -1; z < 1; z++ {
+			if a.HeightAt(x, z) != b.HeightAt(x, z) {
+				t.Error(x, z)
+			}
+		}
+	}
+}
+
+func TestHeightmapEmpty(t *testing.T) {
+	if gen, err := NewHeightmapGenerator(NewPixmapFromImage(image.NewGray(image.Rect(0, 0, 0, 4)))); err == nil || gen != nil {
+		t.Error()
+	}
+	if _, err := NewHeightmapGeneratorFromImage(image.NewGray16(image.Rect(0, 0, 4, 0))); err == nil {
+		t.Error()
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+// MaxLight is the highest light level. Light loses one level per block it travels, except
+// for skylight at full level, which falls down without getting darker.
+const MaxLight = 15
+
+// lightChannel is the shift of a light level inside of the light byte of a block. The block
+// light is stored in the lower 4 bits, the skylight in the upper 4 bits.
+type lightChannel uint
+
+const (
+	blockChannel lightChannel = 0
+	skyChannel   lightChannel = 4
+)
+
+// lightMask masks a single light level
+const lightMask = 0x0F
+
+var lightChannels = [...]lightChannel{blockChannel, skyChannel}
+
+// BlockLight returns the block light level of the block at the given chunk coordinates.
+func (c *Chunk) BlockLight(x, y, z int) uint8 {
+	return c.lightLevel(x, y, z, blockChannel)
+}
+
+// SkyLight returns the skylight level of the block at the given chunk coordinates.
+func (c *Chunk) SkyLight(x, y, z int) uint8 {
+	return c.lightLevel(x, y, z, skyChannel)
+}
+
+func (c *Chunk) lightLevel(x, y, z int, ch lightChannel) uint8 {
+	if c.light == nil {
+		return 0
+	}
+	return c.light[c.IndexAt(x, y, z)] >> ch & lightMask
+}
+
+func (c *Chunk) setLightLevel(x, y, z int, ch lightChannel, level uint8) {
+	if c.light == nil {
+		if level == 0 {
+			return
+		}
+		c.light = make([]uint8, ChunkXYZ)
+	}
+	i := c.IndexAt(x, y, z)
+	c.light[i] = c.light[i]&^(lightMask<<ch) | level<<ch
+}
+
+// lightAt returns the light of the block at the given chunk coordinates. Coordinates outside of
+// the chunk are looked up in the adjacent chunks. Blocks of chunks that are not loaded are dark.
+func lightAt(chunk *Chunk, x, y, z int) uint8 {
+	chunk, x, y, z = localize(chunk, x, y, z)
+	if chunk == nil || chunk.light == nil {
+		return 0
+	}
+	return chunk.light[chunk.IndexAt(x, y, z)]
+}
+
+// ----------------------------------------------------------------------------
+
+// lightNode is a block in the queues of the lightEngine.
+type lightNode struct {
+	chunk   *Chunk
+	x, y, z int
+	level   uint8
+}
+
+// lightQueue is a fifo queue, that reuses its memory.
+type lightQueue struct {
+	nodes []lightNode
+	head  int
+}
+
+func (q *lightQueue) push(chunk *Chunk, x, y, z int, level uint8) {
+	q.nodes = append(q.nodes, lightNode{chunk, x, y, z, level})
+}
+
+func (q *lightQueue) pop() (lightNode, bool) {
+	if q.head == len(q.nodes) {
+		q.nodes, q.head = q.nodes[:0], 0
+		return lightNode{}, false
+	}
+	q.head++
+	return q.nodes[q.head-1], true
+}
+
+// lightEngine spreads the light of emissive blocks & the sky with a breadth first flood fill.
+// Light passes through air & all blocks, that are not opaque cubes, and loses one level per
+// block. It crosses the borders of loaded chunks. Light, that spread from a chunk into its
+// neighbors, stays there when the chunk is removed.
+//
+// The top of a chunk without a loaded chunk above is open to the sky. When the chunk above is
+// loaded later, the skylight of the lower chunk is fixed.
+type lightEngine struct {
+	bank    *BlockBank
+	adds    lightQueue
+	removes lightQueue
+
+	// changed are the positions of all chunks, whose meshes are affected by the changes
+	changed map[ChunkPosition]bool
+}
+
+func newLightEngine(bank *BlockBank) *lightEngine {
+	return &lightEngine{bank: bank, changed: make(map[ChunkPosition]bool)}
+}
+
+// emission returns the light level, that the block emits.
+func (e *lightEngine) emission(block Block) uint8 {
+	if !block.Active() {
+		return 0
+	}
+	if t := e.bank.TypeOf(block); t != nil {
+		return t.Light
+	}
+	return 0
+}
+
+// transmits returns true if light passes through the block.
+func (e *lightEngine) transmits(block Block) bool {
+	return !opaqueCube(e.bank, block)
+}
+
+// source returns the light level, that the block gets without its neighbors. Blocks emit block
+// light, the blocks below the sky get full skylight.
+func (e *lightEngine) source(chunk *Chunk, x, y, z int, ch lightChannel) uint8 {
+	block := chunk.Get(x, y, z)
+	if ch == blockChannel {
+		return e.emission(block)
+	}
+	if y == ChunkHeight-1 && chunk.top == nil && e.transmits(block) {
+		return MaxLight
+	}
+	return 0
+}
+
+// falloff returns the light level, that a node spreads to its neighbor in the direction of
+// the face.
+func falloff(level uint8, face int, ch lightChannel) uint8 {
+	if ch == skyChannel && face == FaceBottom && level == MaxLight {
+		return MaxLight
+	}
+	return level - 1
+}
+
+// set changes the light level of a block & marks the chunks, that show the block.
+func (e *lightEngine) set(chunk *Chunk, x, y, z int, ch lightChannel, level uint8) {
+	chunk.setLightLevel(x, y, z, ch, level)
+
+	// faces of the neighbor chunks are lit by blocks on the border
+	minX, maxX := borderRange(x, ChunkWidth)
+	minY, maxY := borderRange(y, ChunkHeight)
+	minZ, maxZ := borderRange(z, ChunkDepth)
+	pos := chunk.Position
+	for dx := minX; dx <= maxX; dx++ {
+		for dy := minY; dy <= maxY; dy++ {
+			for dz := minZ; dz <= maxZ; dz++ {
+				e.changed[ChunkPosition{pos.X + dx, pos.Y + dy, pos.Z + dz}] = true
+			}
+		}
+	}
+}
+
+// neighbor returns the block next to the given one, in the direction of the face.
+func neighbor(chunk *Chunk, x, y, z, face int) (*Chunk, int, int, int) {
+	pos := [3]int{x, y, z}
+	pos[faceAxes[face][0]] += faceDirections[face]
+	return localize(chunk, pos[0], pos[1], pos[2])
+}
+
+// chunkLight computes the light of the chunk on its own, as if it had no neighbors & was open to
+// the sky. It only reads the blocks, so the workers can call it for chunks, that are not loaded
+// yet. mergeChunk spreads the light across the borders, once the chunk is loaded.
+func chunkLight(bank *BlockBank, chunk *Chunk) []uint8 {
+	// a copy without neighbors, so the light stays inside of the chunk
+	scratch := &Chunk{Position: chunk.Position, blocks: chunk.blocks}
+	e := newLightEngine(bank)
+	for _, ch := range lightChannels {
+		for y := 0; y < ChunkHeight; y++ {
+			for z := 0; z < ChunkDepth; z++ {
+				for x := 0; x < ChunkWidth; x++ {
+					if level := e.source(scratch, x, y, z, ch); level > 0 {
+						scratch.setLightLevel(x, y, z, ch, level)
+						e.adds.push(scratch, x, y, z, level)
+					}
+				}
+			}
+		}
+		e.spread(ch)
+	}
+	return scratch.light
+}
+
+// addChunk lights a chunk, that was just loaded. The light of its emissive blocks & the sky
+// spreads into the neighbors & the light of the neighbors into the chunk.
+func (e *lightEngine) addChunk(chunk *Chunk) {
+	e.mergeChunk(chunk, chunkLight(e.bank, chunk))
+}
+
+// mergeChunk sets the light of a chunk, that was just loaded, to the light computed by
+// chunkLight & spreads it across the borders. Only the light, that crosses the borders, is
+// spread here, the rest is already done.
+func (e *lightEngine) mergeChunk(chunk *Chunk, light []uint8) {
+	chunk.light = light
+
+	// the chunk above was loaded first. The columns, that it covers, are not open to the sky.
+	if above := chunk.top; above != nil {
+		for z := 0; z < ChunkDepth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				if chunk.SkyLight(x, ChunkHeight-1, z) == MaxLight && above.SkyLight(x, 0, z) != MaxLight {
+					e.set(chunk, x, ChunkHeight-1, z, skyChannel, 0)
+					e.removes.push(chunk, x, ChunkHeight-1, z, MaxLight)
+				}
+			}
+		}
+		e.unspread(skyChannel)
+		e.spread(skyChannel)
+	}
+
+	for _, ch := range lightChannels {
+		// the blocks on both sides of the shared borders
+		for face, axes := range faceAxes {
+			d, u, v := axes[0], axes[1], axes[2]
+			size := [3]int{ChunkWidth, ChunkHeight, ChunkDepth}
+			var inner, outer [3]int
+			inner[d], outer[d] = 0, -1
+			if faceDirections[face] > 0 {
+				inner[d], outer[d] = size[d]-1, size[d]
+			}
+			if c, _, _, _ := localize(chunk, outer[0], outer[1], outer[2]); c == nil {
+				continue
+			}
+			for inner[u] = 0; inner[u] < size[u]; inner[u]++ {
+				for inner[v] = 0; inner[v] < size[v]; inner[v]++ {
+					outer[u], outer[v] = inner[u], inner[v]
+					if level := chunk.lightLevel(inner[0], inner[1], inner[2], ch); level > 1 {
+						e.adds.push(chunk, inner[0], inner[1], inner[2], level)
+					}
+					c, x, y, z := localize(chunk, outer[0], outer[1], outer[2])
+					if level := c.lightLevel(x, y, z, ch); level > 1 {
+						e.adds.push(c, x, y, z, level)
+					}
+				}
+			}
+		}
+
+		e.spread(ch)
+	}
+
+	// the chunk below was open to the sky. Its columns, that the new chunk covers, are dark now.
+	if below := chunk.bottom; below != nil {
+		for z := 0; z < ChunkDepth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				if below.SkyLight(x, ChunkHeight-1, z) == MaxLight && chunk.SkyLight(x, 0, z) != MaxLight {
+					e.set(below, x, ChunkHeight-1, z, skyChannel, 0)
+					e.removes.push(below, x, ChunkHeight-1, z, MaxLight)
+				}
+			}
+		}
+		e.unspread(skyChannel)
+		e.spread(skyChannel)
+	}
+}
+
+// update fixes the light after the block at the given chunk coordinates was changed.
+func (e *lightEngine) update(chunk *Chunk, x, y, z int) {
+	e.updateBlocks(chunk, []int{chunk.IndexAt(x, y, z)})
+}
+
+// updateBlocks fixes the light after the blocks at the given indices of the chunk were changed.
+// All blocks are darkened & lit again at once, which is a lot cheaper than updating them one
+// by one.
+func (e *lightEngine) updateBlocks(chunk *Chunk, indices []int) {
+	for _, ch := range lightChannels {
+		for _, i := range indices {
+			x, y, z := i%ChunkWidth, i/ChunkXZ, i%ChunkXZ/ChunkWidth
+			if old := chunk.lightLevel(x, y, z, ch); old > 0 {
+				e.set(chunk, x, y, z, ch, 0)
+				e.removes.push(chunk, x, y, z, old)
+			}
+		}
+		e.unspread(ch)
+
+		for _, i := range indices {
+			x, y, z := i%ChunkWidth, i/ChunkXZ, i%ChunkXZ/ChunkWidth
+			if level := e.source(chunk, x, y, z, ch); level > 0 {
+				e.set(chunk, x, y, z, ch, level)
+				e.adds.push(chunk, x, y, z, level)
+			}
+
+			// light flows into the block from its neighbors
+			if e.transmits(chunk.Get(x, y, z)) {
+				for face := range faceAxes {
+					if c, nx, ny, nz := neighbor(chunk, x, y, z, face); c != nil {
+						if level := c.lightLevel(nx, ny, nz, ch); level > 1 {
+							e.adds.push(c, nx, ny, nz, level)
+						}
+					}
+				}
+			}
+		}
+		e.spread(ch)
+	}
+}
+
+// spread floods the light of all nodes in the add queue into their neighbors.
+func (e *lightEngine) spread(ch lightChannel) {
+	for {
+		n, ok := e.adds.pop()
+		if !ok {
+			return
+		}
+
+		// the block got brighter since it was queued, the brighter node spreads its light
+		if n.chunk.lightLevel(n.x, n.y, n.z, ch) != n.level || n.level <= 1 {
+			continue
+		}
+
+		for face := range faceAxes {
+			level := falloff(n.level, face, ch)
+			c, x, y, z := neighbor(n.chunk, n.x, n.y, n.z, face)
+			if c == nil || c.lightLevel(x, y, z, ch) >= level || !e.transmits(c.Get(x, y, z)) {
+				continue
+			}
+			e.set(c, x, y, z, ch, level)
+			e.adds.push(c, x, y, z, level)
+		}
+	}
+}
+
+// unspread removes the light, that came from the nodes in the remove queue. Neighbors, that are
+// at least as bright as the removed light, got their light from somewhere else. They are queued
+// to spread their light into the darkened area again.
+func (e *lightEngine) unspread(ch lightChannel) {
+	for {
+		n, ok := e.removes.pop()
+		if !ok {
+			return
+		}
+
+		for face := range faceAxes {
+			c, x, y, z := neighbor(n.chunk, n.x, n.y, n.z, face)
+			if c == nil {
+				continue
+			}
+			level := c.lightLevel(x, y, z, ch)
+			if level == 0 {
+				continue
+			}
+			// full skylight below full skylight came from above, even though it is as bright
+			fromAbove := level == MaxLight && falloff(n.level, face, ch) == MaxLight
+			if level >= n.level && !fromAbove {
+				e.adds.push(c, x, y, z, level)
+				continue
+			}
+
+			e.set(c, x, y, z, ch, 0)
+			e.removes.push(c, x, y, z, level)
+			if source := e.source(c, x, y, z, ch); source > 0 {
+				e.set(c, x, y, z, ch, source)
+				e.adds.push(c, x, y, z, source)
+			}
+		}
+	}
+}
+
+// flushChanged returns the positions of the chunks, that were affected since the last call.
+func (e *lightEngine) flushChanged() []ChunkPosition {
+	changed := make([]ChunkPosition, 0, len(e.changed))
+	for pos := range e.changed {
+		changed = append(changed, pos)
+		delete(e.changed, pos)
+	}
+	return changed
+}
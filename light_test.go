@@ -0,0 +1,509 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// newLightBank adds a torch with light level 14 to the test bank
+func newLightBank() (*BlockBank, Block, Block) {
+	bank := newTestBank()
+	region := bank.Types[0].Side
+	bank.AddType(&BlockType{ID: 4, Top: region, Bottom: region, Side: region, Light: 14})
+	stone := Block(0).ChangeType(bank.Types[0]).Activate(true)
+	torch := Block(0).ChangeType(bank.Types[3]).Activate(true)
+	return bank, stone, torch
+}
+
+// newLightChunks creates a row of chunks along x, that are neighbors of each other
+func newLightChunks(count int) []*Chunk {
+	chunks := make(map[ChunkPosition]*Chunk)
+	var row []*Chunk
+	for x := 0; x < count; x++ {
+		chunk := NewChunk(x, 0, 0)
+		chunk.setNeighbors(chunks)
+		chunks[chunk.Position] = chunk
+		row = append(row, chunk)
+	}
+	return row
+}
+
+func TestLightFalloff(t *testing.T) {
+	bank, _, torch := newLightBank()
+	chunk := NewChunk(0, 0, 0)
+	chunk.Set(8, 8, 8, torch)
+	newLightEngine(bank).addChunk(chunk)
+
+	cases := map[[3]int]uint8{
+		{8, 8, 8}: 14, {9, 8, 8}: 13, {8, 8, 12}: 10, {11, 9, 8}: 10, {8, 0, 8}: 6, {0, 0, 0}: 0,
+	}
+	for pos, level := range cases {
+		if l := chunk.BlockLight(pos[0], pos[1], pos[2]); l != level {
+			t.Error(pos, l)
+		}
+	}
+}
+
+func TestLightWalls(t *testing.T) {
+	bank, stone, torch := newLightBank()
+	chunk := NewChunk(0, 0, 0)
+	for y := 0; y < ChunkHeight; y++ {
+		for z := 0; z < ChunkDepth; z++ {
+			chunk.Set(10, y, z, stone)
+		}
+	}
+	chunk.Set(8, 8, 8, torch)
+	engine := newLightEngine(bank)
+	engine.addChunk(chunk)
+
+	if chunk.BlockLight(9, 8, 8) != 13 || chunk.BlockLight(10, 8, 8) != 0 || chunk.BlockLight(11, 8, 8) != 0 {
+		t.Error()
+	}
+
+	// light flows through a hole in the wall
+	chunk.Set(10, 8, 8, Block(0))
+	engine.update(chunk, 10, 8, 8)
+	if chunk.BlockLight(10, 8, 8) != 12 || chunk.BlockLight(11, 8, 8) != 11 || chunk.BlockLight(11, 9, 9) != 9 {
+		t.Error(chunk.BlockLight(10, 8, 8), chunk.BlockLight(11, 8, 8))
+	}
+
+	// & is blocked again when the hole is closed
+	chunk.Set(10, 8, 8, stone)
+	engine.update(chunk, 10, 8, 8)
+	if chunk.BlockLight(10, 8, 8) != 0 || chunk.BlockLight(11, 8, 8) != 0 || chunk.BlockLight(9, 8, 8) != 13 {
+		t.Error()
+	}
+}
+
+func TestLightNeighborChunks(t *testing.T) {
+	bank, _, torch := newLightBank()
+	chunks := newLightChunks(2)
+	left, right := chunks[0], chunks[1]
+	engine := newLightEngine(bank)
+	engine.addChunk(left)
+	engine.addChunk(right)
+	engine.flushChanged()
+
+	left.Set(ChunkWidth-2, 8, 8, torch)
+	engine.update(left, ChunkWidth-2, 8, 8)
+	if right.BlockLight(0, 8, 8) != 12 || right.BlockLight(3, 8, 8) != 9 {
+		t.Error(right.BlockLight(0, 8, 8))
+	}
+
+	// both chunks & the unloaded chunks next to the lit border blocks need new meshes
+	changed := make(map[ChunkPosition]bool)
+	for _, pos := range engine.flushChanged() {
+		changed[pos] = true
+	}
+	if !changed[left.Position] || !changed[right.Position] || !changed[ChunkPosition{0, -1, 0}] {
+		t.Error(changed)
+	}
+	if len(engine.flushChanged()) != 0 {
+		t.Error()
+	}
+}
+
+func TestLightRemoval(t *testing.T) {
+	bank, _, torch := newLightBank()
+	chunks := newLightChunks(2)
+	engine := newLightEngine(bank)
+	chunks[0].Set(ChunkWidth-1, 8, 8, torch)
+	engine.addChunk(chunks[0])
+	engine.addChunk(chunks[1])
+
+	chunks[0].Set(ChunkWidth-1, 8, 8, Block(0))
+	engine.update(chunks[0], ChunkWidth-1, 8, 8)
+	for _, chunk := range chunks {
+		for i, l := range chunk.light {
+			if l&lightMask != 0 {
+				t.Fatal(chunk.Position, i, l)
+			}
+		}
+	}
+}
+
+func TestLightTwoTorches(t *testing.T) {
+	bank, _, torch := newLightBank()
+	chunk := NewChunk(0, 0, 0)
+	chunk.Set(4, 8, 8, torch)
+	chunk.Set(12, 8, 8, torch)
+	engine := newLightEngine(bank)
+	engine.addChunk(chunk)
+	if chunk.BlockLight(8, 8, 8) != 10 {
+		t.Error()
+	}
+
+	// the remaining torch lights the area of the removed one
+	chunk.Set(4, 8, 8, Block(0))
+	engine.update(chunk, 4, 8, 8)
+	cases := map[[3]int]uint8{{4, 8, 8}: 6, {8, 8, 8}: 10, {1, 8, 8}: 3, {12, 8, 8}: 14}
+	for pos, level := range cases {
+		if l := chunk.BlockLight(pos[0], pos[1], pos[2]); l != level {
+			t.Error(pos, l)
+		}
+	}
+}
+
+func TestLightLoadedChunk(t *testing.T) {
+	bank, _, torch := newLightBank()
+	engine := newLightEngine(bank)
+	chunks := make(map[ChunkPosition]*Chunk)
+	left := NewChunk(0, 0, 0)
+	chunks[left.Position] = left
+	left.Set(ChunkWidth-1, 8, 8, torch)
+	engine.addChunk(left)
+
+	// the light of the loaded neighbor spreads into the new chunk
+	right := NewChunk(1, 0, 0)
+	right.setNeighbors(chunks)
+	engine.addChunk(right)
+	if right.BlockLight(0, 8, 8) != 13 || right.BlockLight(5, 8, 8) != 8 {
+		t.Error(right.BlockLight(0, 8, 8))
+	}
+}
+
+func TestMeshLight(t *testing.T) {
+	bank, stone, torch := newLightBank()
+	chunk := NewChunk(0, 0, 0)
+	chunk.Set(5, 8, 8, stone)
+	chunk.Set(8, 8, 8, torch)
+	newLightEngine(bank).addChunk(chunk)
+
+	for _, mesher := range []Mesher{&CulledMesher{}, &GreedyMesher{}} {
+		data := mesher.Generate(chunk, bank)
+		if len(data.Light) != len(data.Positions)/3*2 {
+			t.Fatal(len(data.Light))
+		}
+
+		// the right face of the stone is in front of the block with level 12, under the open sky
+		found := false
+		for i := 0; i < len(data.Normals); i += 12 {
+			if data.Normals[i] != 1 || data.Positions[i] != 6 {
+				continue
+			}
+			found = true
+			for v := i / 3; v < i/3+4; v++ {
+				if data.Light[v*2] != 12.0/MaxLight || data.Light[v*2+1] != 1 {
+					t.Errorf("%T %v", mesher, data.Light[v*2:v*2+2])
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%T", mesher)
+		}
+	}
+}
+
+func TestSkyLight(t *testing.T) {
+	bank, stone, _ := newLightBank()
+	chunk := NewChunk(0, 0, 0)
+	for x := 4; x < 12; x++ {
+		for z := 4; z < 12; z++ {
+			chunk.Set(x, 10, z, stone)
+		}
+	}
+	engine := newLightEngine(bank)
+	engine.addChunk(chunk)
+
+	// the light under the roof comes from the sides
+	cases := map[[3]int]uint8{
+		{0, 0, 0}: 15, {8, 11, 8}: 15, {8, 10, 8}: 0, {8, 9, 8}: 11, {8, 0, 8}: 11, {11, 5, 8}: 14,
+	}
+	for pos, level := range cases {
+		if l := chunk.SkyLight(pos[0], pos[1], pos[2]); l != level {
+			t.Error(pos, l)
+		}
+	}
+
+	// a hole in the roof lets the sky in
+	chunk.Set(8, 10, 8, Block(0))
+	engine.update(chunk, 8, 10, 8)
+	if chunk.SkyLight(8, 10, 8) != 15 || chunk.SkyLight(8, 0, 8) != 15 || chunk.SkyLight(9, 5, 8) != 14 {
+		t.Error(chunk.SkyLight(8, 0, 8))
+	}
+
+	// & closing it darkens the column again
+	chunk.Set(8, 10, 8, stone)
+	engine.update(chunk, 8, 10, 8)
+	for pos, level := range cases {
+		if l := chunk.SkyLight(pos[0], pos[1], pos[2]); l != level {
+			t.Error(pos, l)
+		}
+	}
+}
+
+func TestSkyLightUnderground(t *testing.T) {
+	bank, stone, _ := newLightBank()
+	chunk := NewChunk(0, 0, 0)
+	for y := 0; y < 8; y++ {
+		fillLayer(chunk, y, bank.Types[0])
+	}
+
+	// a shaft down to a tunnel
+	for y := 3; y < 8; y++ {
+		chunk.Set(0, y, 8, Block(0))
+	}
+	for x := 0; x < ChunkWidth; x++ {
+		chunk.Set(x, 3, 8, Block(0))
+	}
+	engine := newLightEngine(bank)
+	engine.addChunk(chunk)
+	if chunk.SkyLight(0, 3, 8) != 15 || chunk.SkyLight(5, 3, 8) != 10 || chunk.SkyLight(15, 3, 8) != 0 {
+		t.Error(chunk.SkyLight(5, 3, 8))
+	}
+
+	// a block in the shaft blocks the sky
+	chunk.Set(0, 6, 8, stone)
+	engine.update(chunk, 0, 6, 8)
+	if chunk.SkyLight(0, 3, 8) != 0 || chunk.SkyLight(5, 3, 8) != 0 || chunk.SkyLight(0, 7, 8) != 15 {
+		t.Error(chunk.SkyLight(0, 3, 8))
+	}
+}
+
+func TestSkyLightStackedChunks(t *testing.T) {
+	bank, stone, _ := newLightBank()
+
+	for _, upperFirst := range []bool{false, true} {
+		engine := newLightEngine(bank)
+		chunks := make(map[ChunkPosition]*Chunk)
+		load := func(chunk *Chunk) {
+			chunk.setNeighbors(chunks)
+			chunks[chunk.Position] = chunk
+			engine.addChunk(chunk)
+		}
+
+		lower, upper := NewChunk(0, 0, 0), NewChunk(0, 1, 0)
+		fillLayer(upper, 0, bank.Types[0])
+		if upperFirst {
+			load(upper)
+			load(lower)
+		} else {
+			load(lower)
+			engine.flushChanged()
+			load(upper)
+		}
+
+		// the floor of the upper chunk covers the whole lower chunk
+		if upper.SkyLight(8, 1, 8) != 15 || lower.SkyLight(8, 15, 8) != 0 || lower.SkyLight(8, 0, 8) != 0 {
+			t.Error(upperFirst, lower.SkyLight(8, 15, 8))
+		}
+		if !upperFirst && !engine.changed[lower.Position] {
+			t.Error("lower chunk is not re-meshed")
+		}
+
+		// the sky falls through a hole in the floor
+		upper.Set(8, 0, 8, Block(0))
+		engine.update(upper, 8, 0, 8)
+		if lower.SkyLight(8, 0, 8) != 15 || lower.SkyLight(9, 0, 8) != 14 || lower.SkyLight(12, 15, 8) != 11 {
+			t.Error(upperFirst, lower.SkyLight(8, 0, 8))
+		}
+		upper.Set(8, 0, 8, stone)
+		engine.update(upper, 8, 0, 8)
+		for i, l := range lower.light {
+			if l != 0 {
+				t.Fatal(upperFirst, i, l)
+			}
+		}
+	}
+}
+
+// newRandomLightChunks creates a 2x2x2 block of chunks with random stone & torches
+func newRandomLightChunks(stone, torch Block, seed int64) []*Chunk {
+	rnd := rand.New(rand.NewSource(seed))
+	var chunks []*Chunk
+	for i := 0; i < 8; i++ {
+		chunk := NewChunk(i&1, i>>1&1, i>>2)
+		for j := 0; j < ChunkXYZ; j++ {
+			switch n := rnd.Intn(100); {
+			case n < 40:
+				chunk.blocks.Set(j, stone)
+			case n < 41:
+				chunk.blocks.Set(j, torch)
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func TestLightLoadOrder(t *testing.T) {
+	bank, stone, torch := newLightBank()
+
+	// the light must not depend on the order the chunks are loaded in
+	var expected []*Chunk
+	for _, order := range [][]int{{0, 1, 2, 3, 4, 5, 6, 7}, {7, 6, 5, 4, 3, 2, 1, 0}, {4, 1, 6, 3, 0, 5, 2, 7}} {
+		chunks := newRandomLightChunks(stone, torch, 5)
+		loaded := make(map[ChunkPosition]*Chunk)
+		engine := newLightEngine(bank)
+		for _, i := range order {
+			chunks[i].setNeighbors(loaded)
+			loaded[chunks[i].Position] = chunks[i]
+			engine.addChunk(chunks[i])
+		}
+		if expected == nil {
+			expected = chunks
+			continue
+		}
+		for i, chunk := range chunks {
+			if string(chunk.light) != string(expected[i].light) {
+				t.Errorf("order %v: chunk %v differs", order, chunk.Position.String())
+			}
+		}
+	}
+}
+
+func TestLightUpdateBlocks(t *testing.T) {
+	bank, stone, torch := newLightBank()
+
+	// a batch of changes results in the same light as changing the blocks one by one
+	var results [2][]*Chunk
+	for batch := range results {
+		chunks := newRandomLightChunks(stone, torch, 6)
+		loaded := make(map[ChunkPosition]*Chunk)
+		engine := newLightEngine(bank)
+		for _, chunk := range chunks {
+			chunk.setNeighbors(loaded)
+			loaded[chunk.Position] = chunk
+			engine.addChunk(chunk)
+		}
+
+		rnd := rand.New(rand.NewSource(7))
+		indices := make([]int, 0)
+		for i := 0; i < 200; i++ {
+			index := rnd.Intn(ChunkXYZ)
+			block := [...]Block{0, stone, torch}[rnd.Intn(3)]
+			chunks[0].blocks.Set(index, block)
+			if batch == 0 {
+				engine.update(chunks[0], index%ChunkWidth, index/ChunkXZ, index%ChunkXZ/ChunkWidth)
+			}
+			indices = append(indices, index)
+		}
+		if batch == 1 {
+			engine.updateBlocks(chunks[0], indices)
+		}
+		results[batch] = chunks
+	}
+	for i := range results[0] {
+		if string(results[0][i].light) != string(results[1][i].light) {
+			t.Errorf("chunk %v differs", results[0][i].Position.String())
+		}
+	}
+}
+
+// topLight maps the vertices of all upwards facing quads at the given height to their block light
+func topLight(t *testing.T, data *MeshData, y float32) map[[2]float32]float32 {
+	light := make(map[[2]float32]float32)
+	for v := 0; v < len(data.Positions)/3; v++ {
+		p := data.Positions[v*3 : v*3+3]
+		if data.Normals[v*3+1] != 1 || p[1] != y {
+			continue
+		}
+		pos := [2]float32{p[0], p[2]}
+		l := data.Light[v*2]
+		if old, ok := light[pos]; ok && old != l {
+			t.Errorf("vertex %v has light %v & %v", pos, old, l)
+		}
+		light[pos] = l
+	}
+	return light
+}
+
+func TestSmoothLightGolden(t *testing.T) {
+	bank, _, torch := newLightBank()
+	chunk := NewChunk(0, 0, 0)
+	fillLayer(chunk, 0, bank.Types[0])
+	chunk.Set(8, 8, 8, torch)
+	newLightEngine(bank).addChunk(chunk)
+
+	// the front blocks of the floor have the level 7 below the torch, 6 & 5 further away.
+	// The vertices around the torch average 7, 6, 6 & 5.
+	golden := map[[2]float32]float32{
+		{8, 7}: 6, {9, 7}: 6, {8, 8}: 6, {9, 8}: 6,
+		{10, 7}: 5, {10, 8}: 5, {7, 7}: 5, {7, 6}: 4, {10, 9}: 4,
+	}
+	culled := (&CulledMesher{SmoothLighting: true}).Generate(chunk, bank)
+	greedy := (&GreedyMesher{SmoothLighting: true}).Generate(chunk, bank)
+	smooth := topLight(t, culled, 1)
+	for pos, level := range golden {
+		if smooth[pos] != level/MaxLight {
+			t.Error(pos, smooth[pos]*MaxLight)
+		}
+	}
+
+	// the light is symmetric around the torch, which spans x 8..9 & z 7..8
+	for pos, l := range smooth {
+		if mirrored, ok := smooth[[2]float32{17 - pos[0], 15 - pos[1]}]; ok && mirrored != l {
+			t.Error(pos, l, mirrored)
+		}
+		if swapped, ok := smooth[[2]float32{pos[1] + 1, pos[0] - 1}]; ok && swapped != l {
+			t.Error(pos, l, swapped)
+		}
+	}
+
+	// the greedy mesher splits the floor where the light changes, with the same vertex light
+	for pos, l := range topLight(t, greedy, 1) {
+		if smooth[pos] != l {
+			t.Error(pos, l, smooth[pos])
+		}
+	}
+	if greedy.IndexCount/6 <= 6 {
+		t.Error(greedy.IndexCount / 6)
+	}
+
+	// flat lighting uses the front block only, so only the face below the torch has level 7
+	flat := (&CulledMesher{}).Generate(chunk, bank)
+	brightest := 0
+	for v := 0; v < len(flat.Positions)/3; v++ {
+		if flat.Normals[v*3+1] == 1 && flat.Light[v*2] == 7.0/MaxLight {
+			brightest++
+		}
+	}
+	if brightest != 4 {
+		t.Error(brightest)
+	}
+}
+
+func TestSmoothLightSeams(t *testing.T) {
+	bank, _, torch := newLightBank()
+	chunks := newLightChunks(2)
+	engine := newLightEngine(bank)
+	for _, chunk := range chunks {
+		fillLayer(chunk, 0, bank.Types[0])
+	}
+	chunks[0].Set(ChunkWidth-1, 3, 8, torch)
+	for _, chunk := range chunks {
+		engine.addChunk(chunk)
+	}
+
+	// the vertices on the shared border get the same light from both chunks
+	for _, mesher := range []Mesher{&CulledMesher{SmoothLighting: true}, &GreedyMesher{SmoothLighting: true}} {
+		left := topLight(t, mesher.Generate(chunks[0], bank), 1)
+		right := topLight(t, mesher.Generate(chunks[1], bank), 1)
+		shared := 0
+		for pos, l := range left {
+			if pos[0] != ChunkWidth {
+				continue
+			}
+			if r, ok := right[pos]; !ok || r != l {
+				t.Errorf("%T %v %v %v", mesher, pos, l, r)
+			}
+			shared++
+		}
+		if shared != ChunkDepth+1 {
+			t.Errorf("%T %v", mesher, shared)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !headless
+// +build !headless
+
+package vox
+
+import (
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+var (
+	// the index buffer shared by all chunk meshes & the number of quads it covers
+	chunkIndexBuffer uint32
+	chunkIndexQuads  int
+)
+
+// ensureChunkIndexBuffer makes the shared index buffer big enough for a mesh with the given
+// number of quads. It starts with 6 quads per block, models can have more. The buffer keeps
+// its name when it grows, so the vertex arrays of the loaded meshes stay valid.
+func ensureChunkIndexBuffer(quads int) {
+	if chunkIndexBuffer == 0 {
+		gl.GenBuffers(1, &chunkIndexBuffer)
+	}
+	if quads <= chunkIndexQuads {
+		return
+	}
+	if chunkIndexQuads == 0 {
+		chunkIndexQuads = ChunkXYZ * 6
+	}
+	for chunkIndexQuads < quads {
+		chunkIndexQuads *= 2
+	}
+
+	indices := chunkIndices(chunkIndexQuads)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, chunkIndexBuffer)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*4, gl.Ptr(indices), gl.STATIC_DRAW)
+}
+
+func NewMesh() *Mesh {
+	mesh := &Mesh{}
+	gl.GenVertexArrays(1, &mesh.vao)
+	gl.GenBuffers(1, &mesh.positionBuffer)
+	gl.GenBuffers(1, &mesh.normalBuffer)
+	gl.GenBuffers(1, &mesh.uvBuffer)
+	gl.GenBuffers(1, &mesh.regionBuffer)
+	gl.GenBuffers(1, &mesh.aoBuffer)
+	gl.GenBuffers(1, &mesh.lightBuffer)
+
+	return mesh
+}
+
+func (m *Mesh) Load(data *MeshData) {
+	// generate or grow the global index buffer
+	ensureChunkIndexBuffer(data.IndexCount / 6)
+
+	positions := data.Positions
+	normals := data.Normals
+	uvs := data.Uvs
+	regions := data.Regions
+	occlusion := data.Occlusion
+	light := data.Light
+
+	gl.BindVertexArray(m.vao)
+
+	// bind global index buffer
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, chunkIndexBuffer)
+
+	// positions
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.positionBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, len(positions)*4, gl.Ptr(positions), gl.STATIC_DRAW)
+	gl.VertexAttribPointer(AttribIndexPositions, 3, gl.FLOAT, false, 0, gl.PtrOffset(0))
+
+	// normals
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.normalBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, len(normals)*4, gl.Ptr(normals), gl.STATIC_DRAW)
+	gl.VertexAttribPointer(AttribIndexNormals, 3, gl.FLOAT, false, 0, gl.PtrOffset(0))
+
+	// uvs
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.uvBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, len(uvs)*4, gl.Ptr(uvs), gl.STATIC_DRAW)
+	gl.VertexAttribPointer(AttribIndexUvs, 2, gl.FLOAT, false, 0, gl.PtrOffset(0))
+
+	// texture regions
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.regionBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, len(regions)*4, gl.Ptr(regions), gl.STATIC_DRAW)
+	gl.VertexAttribPointer(AttribIndexRegions, 4, gl.FLOAT, false, 0, gl.PtrOffset(0))
+
+	// ambient occlusion
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.aoBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, len(occlusion)*4, gl.Ptr(occlusion), gl.STATIC_DRAW)
+	gl.VertexAttribPointer(AttribIndexOcclusion, 1, gl.FLOAT, false, 0, gl.PtrOffset(0))
+
+	// light
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.lightBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, len(light)*4, gl.Ptr(light), gl.STATIC_DRAW)
+	gl.VertexAttribPointer(AttribIndexLight, 2, gl.FLOAT, false, 0, gl.PtrOffset(0))
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindVertexArray(0)
+
+	m.IndexCount = int32(data.IndexCount)
+	for i, count := range data.LayerIndexCounts {
+		m.LayerIndexCounts[i] = int32(count)
+	}
+}
+
+// DrawLayer draws the section of a render layer. The mesh must be bound.
+func (m *Mesh) DrawLayer(layer RenderLayer) {
+	count := m.LayerIndexCounts[layer]
+	if count == 0 {
+		return
+	}
+	var offset int32
+	for l := RenderLayer(0); l < layer; l++ {
+		offset += m.LayerIndexCounts[l]
+	}
+	gl.DrawElements(gl.TRIANGLES, count, gl.UNSIGNED_INT, gl.PtrOffset(int(offset)*4))
+}
+
+func (m *Mesh) Bind() {
+	gl.BindVertexArray(m.vao)
+	gl.EnableVertexAttribArray(AttribIndexPositions)
+	gl.EnableVertexAttribArray(AttribIndexUvs)
+	gl.EnableVertexAttribArray(AttribIndexNormals)
+	gl.EnableVertexAttribArray(AttribIndexRegions)
+	gl.EnableVertexAttribArray(AttribIndexOcclusion)
+	gl.EnableVertexAttribArray(AttribIndexLight)
+}
+
+func (m *Mesh) Unbind() {
+	gl.DisableVertexAttribArray(AttribIndexLight)
+	gl.DisableVertexAttribArray(AttribIndexOcclusion)
+	gl.DisableVertexAttribArray(AttribIndexRegions)
+	gl.DisableVertexAttribArray(AttribIndexNormals)
+	gl.DisableVertexAttribArray(AttribIndexUvs)
+	gl.DisableVertexAttribArray(AttribIndexPositions)
+	gl.BindVertexArray(0)
+}
+
+func (m *Mesh) Dispose() {
+	gl.DeleteBuffers(1, &m.positionBuffer)
+	gl.DeleteBuffers(1, &m.uvBuffer)
+	gl.DeleteBuffers(1, &m.normalBuffer)
+	gl.DeleteBuffers(1, &m.regionBuffer)
+	gl.DeleteBuffers(1, &m.aoBuffer)
+	gl.DeleteBuffers(1, &m.lightBuffer)
+	gl.DeleteVertexArrays(1, &m.vao)
+}
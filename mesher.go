@@ -19,20 +19,323 @@ type Mesher interface {
 	Generate(chunk *Chunk, bank *BlockBank) *MeshData
 }
 
+// The faces of a block. Left is -x, bottom is -y and back is -z.
+const (
+	FaceLeft = iota
+	FaceRight
+	FaceBottom
+	FaceTop
+	FaceBack
+	FaceFront
+)
+
+// the normal, u and v axis of every face. The quads of a face span the u & v axis.
+var faceAxes = [6][3]int{
+	FaceLeft:   {0, 2, 1},
+	FaceRight:  {0, 2, 1},
+	FaceBottom: {1, 0, 2},
+	FaceTop:    {1, 0, 2},
+	FaceBack:   {2, 0, 1},
+	FaceFront:  {2, 0, 1},
+}
+
+// the direction of the face normal along the normal axis
+var faceDirections = [6]int{-1, 1, -1, 1, -1, 1}
+
+// the offsets of the four face vertices relative to the block center (in the face plane).
+// The order matches the vertex order of the meshers.
+var faceCorners = [6][4][3]int{
+	FaceLeft:   {{0, -1, -1}, {0, -1, 1}, {0, 1, 1}, {0, 1, -1}},
+	FaceRight:  {{0, -1, 1}, {0, -1, -1}, {0, 1, -1}, {0, 1, 1}},
+	FaceBottom: {{-1, 0, 1}, {1, 0, 1}, {1, 0, -1}, {-1, 0, -1}},
+	FaceTop:    {{-1, 0, 1}, {1, 0, 1}, {1, 0, -1}, {-1, 0, -1}},
+	FaceBack:   {{-1, -1, 0}, {1, -1, 0}, {1, 1, 0}, {-1, 1, 0}},
+	FaceFront:  {{-1, -1, 0}, {1, -1, 0}, {1, 1, 0}, {-1, 1, 0}},
+}
+
+// addUvs adds the texture coordinates of a quad, that is width x height blocks
+// in size. The uvs are in tile space (0..width, 0..height) and get wrapped into
+// the atlas region by the shader, so the texture repeats on merged quads. The
+// transform rotates or mirrors the texture of oriented blocks.
+func addUvs(data *MeshData, region *TextureRegion, width, height float32, transform *uvTransform) {
+	for _, c := range [4][2]float32{{0, 0}, {width, 0}, {width, height}, {0, height}} {
+		data.Uvs = append(data.Uvs,
+			float32(transform[0])*c[0]+float32(transform[1])*c[1],
+			float32(transform[2])*c[0]+float32(transform[3])*c[1],
+		)
+	}
+
+	addRegion(data, region)
+}
+
+// addRegion adds the atlas region of the last quad.
+func addRegion(data *MeshData, region *TextureRegion) {
+	uvs := &region.Uvs
+	x, y := uvs[0].X, uvs[0].Y
+	w, h := uvs[2].X-uvs[0].X, uvs[2].Y-uvs[0].Y
+	data.Regions = append(data.Regions,
+		x, y, w, h,
+		x, y, w, h,
+		x, y, w, h,
+		x, y, w, h,
+	)
+}
+
+// blockAt returns the block at the given chunk coordinates. Coordinates outside of the chunk
+// are looked up in the adjacent chunks. Blocks of chunks that are not loaded are BlockNil.
+func blockAt(chunk *Chunk, x, y, z int) Block {
+	chunk, x, y, z = localize(chunk, x, y, z)
+	if chunk == nil {
+		return BlockNil
+	}
+	return chunk.Get(x, y, z)
+}
+
+// localize follows the neighbors of the chunk to the chunk, that contains the given chunk
+// coordinates, & returns the coordinates inside of that chunk. The chunk is nil if it is
+// not loaded.
+func localize(chunk *Chunk, x, y, z int) (*Chunk, int, int, int) {
+	for chunk != nil && x < 0 {
+		chunk, x = chunk.left, x+ChunkWidth
+	}
+	for chunk != nil && x >= ChunkWidth {
+		chunk, x = chunk.right, x-ChunkWidth
+	}
+	for chunk != nil && y < 0 {
+		chunk, y = chunk.bottom, y+ChunkHeight
+	}
+	for chunk != nil && y >= ChunkHeight {
+		chunk, y = chunk.top, y-ChunkHeight
+	}
+	for chunk != nil && z < 0 {
+		chunk, z = chunk.back, z+ChunkDepth
+	}
+	for chunk != nil && z >= ChunkDepth {
+		chunk, z = chunk.front, z-ChunkDepth
+	}
+	return chunk, x, y, z
+}
+
+// opaqueCube returns true if the block is an active & opaque unit cube. Only these blocks stop
+// light & cast ambient occlusion, sprites, slabs or glass don't.
+func opaqueCube(bank *BlockBank, block Block) bool {
+	if !block.Active() {
+		return false
+	}
+	t := bank.TypeOf(block)
+	return t == nil || (t.Layer == LayerOpaque && t.isCube())
+}
+
+// opaqueAt returns true if the block at the given chunk coordinates is an opaque cube.
+// Coordinates outside of the chunk are looked up in the adjacent chunks.
+// Blocks of chunks that are not loaded count as empty.
+func opaqueAt(bank *BlockBank, chunk *Chunk, x, y, z int) bool {
+	return opaqueCube(bank, blockAt(chunk, x, y, z))
+}
+
+// faceVisible returns true if the given face of the block of the given type at x, y, z is
+// visible. Only neighbors, whose model covers the whole shared side, can hide it. Opaque
+// neighbors always do, transparent ones only if they are of the same type, so there are no
+// faces between two glass blocks.
+func faceVisible(bank *BlockBank, blockType *BlockType, chunk *Chunk, face, x, y, z int) bool {
+	pos := [3]int{x, y, z}
+	pos[faceAxes[face][0]] += faceDirections[face]
+	neighbor := blockAt(chunk, pos[0], pos[1], pos[2])
+	if !neighbor.Active() {
+		return true
+	}
+	neighborType := bank.TypeOf(neighbor)
+	if neighborType == nil || !neighborType.occludes(neighbor, oppositeFace(face)) {
+		return true
+	}
+	if neighborType.Layer == LayerOpaque {
+		return false
+	}
+	return neighborType != blockType
+}
+
+// oppositeFace returns the face on the other side of the block.
+func oppositeFace(face int) int {
+	return face ^ 1
+}
+
+// faceOcclusion computes the ambient occlusion of the four vertices of a block face.
+// Every vertex is occluded by the two side blocks & the corner block in front of the face, if
+// they are opaque cubes. The values range from 0 (fully occluded) to 3 (not occluded).
+func faceOcclusion(bank *BlockBank, chunk *Chunk, face, x, y, z int) [4]uint8 {
+	var ao [4]uint8
+	axes := &faceAxes[face]
+	u, v := axes[1], axes[2]
+
+	// the layer of blocks in front of the face
+	front := [3]int{x, y, z}
+	front[axes[0]] += faceDirections[face]
+
+	for i, corner := range faceCorners[face] {
+		side1, side2, diagonal := cornerBlocks(front, corner, u, v)
+		s1 := opaqueAt(bank, chunk, side1[0], side1[1], side1[2])
+		s2 := opaqueAt(bank, chunk, side2[0], side2[1], side2[2])
+		if s1 && s2 {
+			ao[i] = 0
+			continue
+		}
+
+		ao[i] = 3
+		if s1 {
+			ao[i]--
+		}
+		if s2 {
+			ao[i]--
+		}
+		if opaqueAt(bank, chunk, diagonal[0], diagonal[1], diagonal[2]) {
+			ao[i]--
+		}
+	}
+
+	return ao
+}
+
+// cornerBlocks returns the two side blocks & the diagonal block next to a face corner. They are
+// in the same layer as the front block, which is the block in front of the face.
+func cornerBlocks(front, corner [3]int, u, v int) (side1, side2, diagonal [3]int) {
+	side1, side2, diagonal = front, front, front
+	side1[u] += corner[u]
+	side2[v] += corner[v]
+	diagonal[u] += corner[u]
+	diagonal[v] += corner[v]
+	return side1, side2, diagonal
+}
+
+// quadLight is the block & skylight of the four vertices of a quad, from 0 (dark) to 1 (MaxLight).
+type quadLight [4][2]float32
+
+// flatLight lights all four vertices with the light of a single block.
+func flatLight(light uint8) quadLight {
+	vertex := [2]float32{
+		float32(light>>blockChannel&lightMask) / MaxLight,
+		float32(light>>skyChannel&lightMask) / MaxLight,
+	}
+	return quadLight{vertex, vertex, vertex, vertex}
+}
+
+// faceLight returns the light of the four vertices of a block face. Faces are lit by the block
+// in front of them. With smooth lighting every vertex gets the average light of the blocks in
+// front of the face, that touch the vertex. Opaque cubes are skipped & so is the diagonal
+// block, if both side blocks are opaque, just like with the ambient occlusion.
+func faceLight(bank *BlockBank, chunk *Chunk, face, x, y, z int, smooth bool) quadLight {
+	axes := &faceAxes[face]
+	front := [3]int{x, y, z}
+	front[axes[0]] += faceDirections[face]
+	frontLight := lightAt(chunk, front[0], front[1], front[2])
+	if !smooth {
+		return flatLight(frontLight)
+	}
+
+	var light quadLight
+	for i, corner := range faceCorners[face] {
+		side1, side2, diagonal := cornerBlocks(front, corner, axes[1], axes[2])
+		s1 := opaqueAt(bank, chunk, side1[0], side1[1], side1[2])
+		s2 := opaqueAt(bank, chunk, side2[0], side2[1], side2[2])
+
+		samples := []uint8{frontLight}
+		if !s1 {
+			samples = append(samples, lightAt(chunk, side1[0], side1[1], side1[2]))
+		}
+		if !s2 {
+			samples = append(samples, lightAt(chunk, side2[0], side2[1], side2[2]))
+		}
+		if !(s1 && s2) && !opaqueAt(bank, chunk, diagonal[0], diagonal[1], diagonal[2]) {
+			samples = append(samples, lightAt(chunk, diagonal[0], diagonal[1], diagonal[2]))
+		}
+
+		var blockLight, skyLight int
+		for _, l := range samples {
+			blockLight += int(l >> blockChannel & lightMask)
+			skyLight += int(l >> skyChannel & lightMask)
+		}
+		n := float32(len(samples) * MaxLight)
+		light[i] = [2]float32{float32(blockLight) / n, float32(skyLight) / n}
+	}
+	return light
+}
+
+// addLight adds the block & skylight of the four vertices of the last quad.
+func addLight(data *MeshData, light quadLight) {
+	for _, l := range light {
+		data.Light = append(data.Light, l[0], l[1])
+	}
+}
+
+// addOcclusion adds the ambient occlusion of the last quad & completes it. By default quads
+// are split into two triangles along the v0-v2 diagonal. If the v1-v3 diagonal is brighter,
+// the vertices are rotated so that the split follows that diagonal instead. Otherwise the
+// interpolation across the triangles would make the occlusion look anisotropic.
+func addOcclusion(data *MeshData, ao [4]uint8) {
+	data.Occlusion = append(data.Occlusion,
+		float32(ao[0])/3,
+		float32(ao[1])/3,
+		float32(ao[2])/3,
+		float32(ao[3])/3,
+	)
+
+	if int(ao[1])+int(ao[3]) > int(ao[0])+int(ao[2]) {
+		rotateQuad(data.Positions, 3)
+		rotateQuad(data.Normals, 3)
+		rotateQuad(data.Uvs, 2)
+		rotateQuad(data.Regions, 4)
+		rotateQuad(data.Light, 2)
+		rotateQuad(data.Occlusion, 1)
+	}
+}
+
+// rotateQuad moves the first vertex of the last quad to the end. The quad stays the same,
+// but the triangulation of the index buffer uses the other diagonal.
+func rotateQuad(values []float32, stride int) {
+	quad := values[len(values)-4*stride:]
+	var first [4]float32
+	copy(first[:], quad[:stride])
+	copy(quad, quad[stride:])
+	copy(quad[3*stride:], first[:stride])
+}
+
+// mergeLayers appends the quads of all render layers in layer order. Returns nil if
+// there are no quads at all.
+func mergeLayers(layers *[renderLayerCount]MeshData) *MeshData {
+	data := &MeshData{}
+	for i := range layers {
+		layer := &layers[i]
+		data.Positions = append(data.Positions, layer.Positions...)
+		data.Normals = append(data.Normals, layer.Normals...)
+		data.Uvs = append(data.Uvs, layer.Uvs...)
+		data.Regions = append(data.Regions, layer.Regions...)
+		data.Light = append(data.Light, layer.Light...)
+		data.Occlusion = append(data.Occlusion, layer.Occlusion...)
+		data.IndexCount += layer.IndexCount
+		data.LayerIndexCounts[i] = layer.IndexCount
+	}
+
+	if len(data.Positions) == 0 {
+		return nil
+	}
+	return data
+}
+
 // ----------------------------------------------------------------------------
 
 type CulledMesher struct {
+	// SmoothLighting interpolates the light between the vertices of a face. Otherwise every
+	// face is lit evenly by the block in front of it, which is cheaper.
+	SmoothLighting bool
 }
 
 func (cm *CulledMesher) Generate(chunk *Chunk, bank *BlockBank) *MeshData {
-	data := &MeshData{}
+	var layers [renderLayerCount]MeshData
 
 	// these are the offset in world coordinates of the chunk
 	xOffset := float32(chunk.Position.X) * ChunkWidth
 	yOffset := float32(chunk.Position.Y) * ChunkHeight
 	zOffset := float32(chunk.Position.Z) * ChunkDepth
 
-	hasFace := false
 	for x := 0; x < ChunkWidth; x++ {
 		for z := 0; z < ChunkDepth; z++ {
 			for y := 0; y < ChunkHeight; y++ {
@@ -42,83 +345,57 @@ func (cm *CulledMesher) Generate(chunk *Chunk, bank *BlockBank) *MeshData {
 					continue
 				}
 
+				// blocks of unknown types are not meshed
 				blockType := bank.TypeOf(block)
+				if blockType == nil {
+					continue
+				}
+				data := &layers[blockType.Layer]
 
 				// get offsets
 				xx := xOffset + float32(x)
 				yy := yOffset + float32(y)
 				zz := zOffset + float32(z)
 
-				// get sourrounding neighbors
-				left := chunk.Get(x-1, y, z)
-				right := chunk.Get(x+1, y, z)
-				top := chunk.Get(x, y+1, z)
-				bottom := chunk.Get(x, y-1, z)
-				front := chunk.Get(x, y, z+1)
-				back := chunk.Get(x, y, z-1)
-
-				// left face
-				hasFace = left == BlockNil && (chunk.left == nil || !chunk.left.Get(ChunkWidth-1, y, z).Active()) // check if adjacient chunk has occluding block
-				hasFace = hasFace || left != BlockNil && !left.Active()                                           // check if there is a adjacient block in the same chunk
-				if hasFace {
-					cm.addLeftFace(xx, yy, zz, data, blockType)
+				if !blockType.isCube() {
+					addModel(data, bank, chunk, block, x, y, z, xx, yy, zz)
+					continue
 				}
 
-				// right face
-				hasFace = right == BlockNil && (chunk.right == nil || !chunk.right.Get(0, y, z).Active())
-				hasFace = hasFace || right != BlockNil && !right.Active()
-				if hasFace {
-					cm.addRightFace(xx, yy, zz, data, blockType)
+				// add the faces, that are not hidden by a neighbor. Neighbors outside of the
+				// chunk are looked up in the adjacent chunks.
+				if faceVisible(bank, blockType, chunk, FaceLeft, x, y, z) {
+					cm.addLeftFace(xx, yy, zz, data, blockType.faceTexture(block, FaceLeft),
+						faceLight(bank, chunk, FaceLeft, x, y, z, cm.SmoothLighting), faceOcclusion(bank, chunk, FaceLeft, x, y, z))
 				}
-
-				// top face
-				hasFace = top == BlockNil && (chunk.top == nil || !chunk.top.Get(x, 0, z).Active())
-				hasFace = hasFace || top != BlockNil && !top.Active()
-				if hasFace {
-					cm.addTopFace(xx, yy, zz, data, blockType)
+				if faceVisible(bank, blockType, chunk, FaceRight, x, y, z) {
+					cm.addRightFace(xx, yy, zz, data, blockType.faceTexture(block, FaceRight),
+						faceLight(bank, chunk, FaceRight, x, y, z, cm.SmoothLighting), faceOcclusion(bank, chunk, FaceRight, x, y, z))
 				}
-
-				// bottom face
-				hasFace = bottom == BlockNil && (chunk.bottom == nil || !chunk.bottom.Get(x, ChunkHeight-1, z).Active())
-				hasFace = hasFace || bottom != BlockNil && !bottom.Active()
-				if hasFace {
-					cm.addBottomFace(xx, yy, zz, data, blockType)
+				if faceVisible(bank, blockType, chunk, FaceTop, x, y, z) {
+					cm.addTopFace(xx, yy, zz, data, blockType.faceTexture(block, FaceTop),
+						faceLight(bank, chunk, FaceTop, x, y, z, cm.SmoothLighting), faceOcclusion(bank, chunk, FaceTop, x, y, z))
 				}
-
-				// front face
-				hasFace = front == BlockNil && (chunk.front == nil || !chunk.front.Get(x, y, 0).Active())
-				hasFace = hasFace || front != BlockNil && !front.Active()
-				if hasFace {
-					cm.addFrontFace(xx, yy, zz, data, blockType)
+				if faceVisible(bank, blockType, chunk, FaceBottom, x, y, z) {
+					cm.addBottomFace(xx, yy, zz, data, blockType.faceTexture(block, FaceBottom),
+						faceLight(bank, chunk, FaceBottom, x, y, z, cm.SmoothLighting), faceOcclusion(bank, chunk, FaceBottom, x, y, z))
 				}
-
-				// back face
-				hasFace = back == BlockNil && (chunk.back == nil || !chunk.back.Get(x, y, ChunkDepth-1).Active())
-				hasFace = hasFace || back != BlockNil && !back.Active()
-				if hasFace {
-					cm.addBackFace(xx, yy, zz, data, blockType)
+				if faceVisible(bank, blockType, chunk, FaceFront, x, y, z) {
+					cm.addFrontFace(xx, yy, zz, data, blockType.faceTexture(block, FaceFront),
+						faceLight(bank, chunk, FaceFront, x, y, z, cm.SmoothLighting), faceOcclusion(bank, chunk, FaceFront, x, y, z))
+				}
+				if faceVisible(bank, blockType, chunk, FaceBack, x, y, z) {
+					cm.addBackFace(xx, yy, zz, data, blockType.faceTexture(block, FaceBack),
+						faceLight(bank, chunk, FaceBack, x, y, z, cm.SmoothLighting), faceOcclusion(bank, chunk, FaceBack, x, y, z))
 				}
 			}
 		}
 	}
 
-	if len(data.Positions) == 0 {
-		return nil
-	}
-	return data
+	return mergeLayers(&layers)
 }
 
-func (cm *CulledMesher) addUvs(data *MeshData, region *TextureRegion) {
-	uvs := &region.Uvs
-	data.Uvs = append(data.Uvs,
-		uvs[0].X, uvs[0].Y,
-		uvs[1].X, uvs[1].Y,
-		uvs[2].X, uvs[2].Y,
-		uvs[3].X, uvs[3].Y,
-	)
-}
-
-func (cm *CulledMesher) addLeftFace(x, y, z float32, data *MeshData, blockType *BlockType) {
+func (cm *CulledMesher) addLeftFace(x, y, z float32, data *MeshData, tex faceTexture, light quadLight, ao [4]uint8) {
 	data.Positions = append(data.Positions,
 		x, y, z-CubeSize,
 		x, y, z,
@@ -131,11 +408,13 @@ func (cm *CulledMesher) addLeftFace(x, y, z float32, data *MeshData, blockType *
 		-1, 0, 0,
 		-1, 0, 0,
 	)
-	cm.addUvs(data, blockType.Side)
+	addUvs(data, tex.region, 1, 1, &tex.transform)
+	addLight(data, light)
+	addOcclusion(data, ao)
 	data.IndexCount += 6
 }
 
-func (cm *CulledMesher) addRightFace(x, y, z float32, data *MeshData, blockType *BlockType) {
+func (cm *CulledMesher) addRightFace(x, y, z float32, data *MeshData, tex faceTexture, light quadLight, ao [4]uint8) {
 	data.Positions = append(data.Positions,
 		x+CubeSize, y, z,
 		x+CubeSize, y, z-CubeSize,
@@ -148,11 +427,13 @@ func (cm *CulledMesher) addRightFace(x, y, z float32, data *MeshData, blockType
 		1, 0, 0,
 		1, 0, 0,
 	)
-	cm.addUvs(data, blockType.Side)
+	addUvs(data, tex.region, 1, 1, &tex.transform)
+	addLight(data, light)
+	addOcclusion(data, ao)
 	data.IndexCount += 6
 }
 
-func (cm *CulledMesher) addTopFace(x, y, z float32, data *MeshData, blockType *BlockType) {
+func (cm *CulledMesher) addTopFace(x, y, z float32, data *MeshData, tex faceTexture, light quadLight, ao [4]uint8) {
 	data.Positions = append(data.Positions,
 		x, y+CubeSize, z,
 		x+CubeSize, y+CubeSize, z,
@@ -165,11 +446,13 @@ func (cm *CulledMesher) addTopFace(x, y, z float32, data *MeshData, blockType *B
 		0, 1, 0,
 		0, 1, 0,
 	)
-	cm.addUvs(data, blockType.Top)
+	addUvs(data, tex.region, 1, 1, &tex.transform)
+	addLight(data, light)
+	addOcclusion(data, ao)
 	data.IndexCount += 6
 }
 
-func (cm *CulledMesher) addBottomFace(x, y, z float32, data *MeshData, blockType *BlockType) {
+func (cm *CulledMesher) addBottomFace(x, y, z float32, data *MeshData, tex faceTexture, light quadLight, ao [4]uint8) {
 	data.Positions = append(data.Positions,
 		x, y, z,
 		x+CubeSize, y, z,
@@ -182,11 +465,13 @@ func (cm *CulledMesher) addBottomFace(x, y, z float32, data *MeshData, blockType
 		0, -1, 0,
 		0, -1, 0,
 	)
-	cm.addUvs(data, blockType.Bottom)
+	addUvs(data, tex.region, 1, 1, &tex.transform)
+	addLight(data, light)
+	addOcclusion(data, ao)
 	data.IndexCount += 6
 }
 
-func (cm *CulledMesher) addFrontFace(x, y, z float32, data *MeshData, blockType *BlockType) {
+func (cm *CulledMesher) addFrontFace(x, y, z float32, data *MeshData, tex faceTexture, light quadLight, ao [4]uint8) {
 	data.Positions = append(data.Positions,
 		x, y, z,
 		x+CubeSize, y, z,
@@ -199,11 +484,13 @@ func (cm *CulledMesher) addFrontFace(x, y, z float32, data *MeshData, blockType
 		0, 0, 1,
 		0, 0, 1,
 	)
-	cm.addUvs(data, blockType.Side)
+	addUvs(data, tex.region, 1, 1, &tex.transform)
+	addLight(data, light)
+	addOcclusion(data, ao)
 	data.IndexCount += 6
 }
 
-func (cm *CulledMesher) addBackFace(x, y, z float32, data *MeshData, blockType *BlockType) {
+func (cm *CulledMesher) addBackFace(x, y, z float32, data *MeshData, tex faceTexture, light quadLight, ao [4]uint8) {
 	data.Positions = append(data.Positions,
 		x, y, z-CubeSize,
 		x+CubeSize, y, z-CubeSize,
@@ -216,6 +503,198 @@ func (cm *CulledMesher) addBackFace(x, y, z float32, data *MeshData, blockType *
 		0, 0, -1,
 		0, 0, -1,
 	)
-	cm.addUvs(data, blockType.Side)
+	addUvs(data, tex.region, 1, 1, &tex.transform)
+	addLight(data, light)
+	addOcclusion(data, ao)
+	data.IndexCount += 6
+}
+
+// ----------------------------------------------------------------------------
+
+// GreedyMesher merges adjacent & coplanar faces, that share the same texture region,
+// into bigger quads. Large flat surfaces need a lot less vertices than with the CulledMesher.
+type GreedyMesher struct {
+	// SmoothLighting interpolates the light between the vertices of a face. Faces with
+	// different light are not merged, so smooth lighting produces more quads.
+	SmoothLighting bool
+}
+
+// greedyFace is a visible block face in the mask of a slice. Faces can only be
+// merged if their texture, texture orientation, render layer, light & ambient occlusion are equal.
+type greedyFace struct {
+	texture faceTexture
+	layer   RenderLayer
+	light   quadLight
+	ao      [4]uint8
+}
+
+func (gm *GreedyMesher) Generate(chunk *Chunk, bank *BlockBank) *MeshData {
+	var layers [renderLayerCount]MeshData
+
+	// these are the offset in world coordinates of the chunk
+	xOffset := float32(chunk.Position.X) * ChunkWidth
+	yOffset := float32(chunk.Position.Y) * ChunkHeight
+	zOffset := float32(chunk.Position.Z) * ChunkDepth
+
+	// blocks with a model are not merged
+	for x := 0; x < ChunkWidth; x++ {
+		for z := 0; z < ChunkDepth; z++ {
+			for y := 0; y < ChunkHeight; y++ {
+				block := chunk.Get(x, y, z)
+				if !block.Active() {
+					continue
+				}
+				if blockType := bank.TypeOf(block); blockType != nil && !blockType.isCube() {
+					addModel(&layers[blockType.Layer], bank, chunk, block, x, y, z,
+						xOffset+float32(x), yOffset+float32(y), zOffset+float32(z))
+				}
+			}
+		}
+	}
+
+	size := [3]int{ChunkWidth, ChunkHeight, ChunkDepth}
+	var pos [3]int
+	for face, axes := range faceAxes {
+		d, u, v := axes[0], axes[1], axes[2]
+		mask := make([]greedyFace, size[u]*size[v])
+
+		for pos[d] = 0; pos[d] < size[d]; pos[d]++ {
+			// find all visible faces of this slice
+			for pos[v] = 0; pos[v] < size[v]; pos[v]++ {
+				for pos[u] = 0; pos[u] < size[u]; pos[u]++ {
+					i := pos[u] + pos[v]*size[u]
+					mask[i] = greedyFace{}
+
+					block := chunk.Get(pos[0], pos[1], pos[2])
+					if !block.Active() {
+						continue
+					}
+					blockType := bank.TypeOf(block)
+					if blockType == nil || !blockType.isCube() {
+						continue
+					}
+					if faceVisible(bank, blockType, chunk, face, pos[0], pos[1], pos[2]) {
+						mask[i] = greedyFace{
+							texture: blockType.faceTexture(block, face),
+							layer:   blockType.Layer,
+							light:   faceLight(bank, chunk, face, pos[0], pos[1], pos[2], gm.SmoothLighting),
+							ao:      faceOcclusion(bank, chunk, face, pos[0], pos[1], pos[2]),
+						}
+					}
+				}
+			}
+
+			// merge the faces into as few quads as possible
+			for b := 0; b < size[v]; b++ {
+				for a := 0; a < size[u]; {
+					current := mask[a+b*size[u]]
+					if current.texture.region == nil {
+						a++
+						continue
+					}
+
+					// grow along the u axis
+					w := 1
+					for a+w < size[u] && mask[a+w+b*size[u]] == current {
+						w++
+					}
+
+					// grow along the v axis, as long as the whole row matches
+					h := 1
+				grow:
+					for b+h < size[v] {
+						for k := 0; k < w; k++ {
+							if mask[a+k+(b+h)*size[u]] != current {
+								break grow
+							}
+						}
+						h++
+					}
+
+					// remove merged faces from the mask
+					for j := 0; j < h; j++ {
+						for k := 0; k < w; k++ {
+							mask[a+k+(b+j)*size[u]] = greedyFace{}
+						}
+					}
+
+					pos[u], pos[v] = a, b
+					gm.addQuad(&layers[current.layer], face,
+						xOffset+float32(pos[0]), yOffset+float32(pos[1]), zOffset+float32(pos[2]),
+						float32(w), float32(h), &current)
+
+					a += w
+				}
+			}
+		}
+	}
+
+	return mergeLayers(&layers)
+}
+
+// addQuad adds a quad of w x h blocks. x, y, z are the world coordinates of the block
+// with the lowest u & v coordinates. The vertex order is the same as in the CulledMesher.
+func (gm *GreedyMesher) addQuad(data *MeshData, face int, x, y, z, w, h float32, quad *greedyFace) {
+	var nx, ny, nz float32
+	switch face {
+	case FaceLeft:
+		nx = -1
+		data.Positions = append(data.Positions,
+			x, y, z-CubeSize,
+			x, y, z-CubeSize+w,
+			x, y+h, z-CubeSize+w,
+			x, y+h, z-CubeSize,
+		)
+	case FaceRight:
+		nx = 1
+		data.Positions = append(data.Positions,
+			x+CubeSize, y, z-CubeSize+w,
+			x+CubeSize, y, z-CubeSize,
+			x+CubeSize, y+h, z-CubeSize,
+			x+CubeSize, y+h, z-CubeSize+w,
+		)
+	case FaceBottom:
+		ny = -1
+		data.Positions = append(data.Positions,
+			x, y, z-CubeSize+h,
+			x+w, y, z-CubeSize+h,
+			x+w, y, z-CubeSize,
+			x, y, z-CubeSize,
+		)
+	case FaceTop:
+		ny = 1
+		data.Positions = append(data.Positions,
+			x, y+CubeSize, z-CubeSize+h,
+			x+w, y+CubeSize, z-CubeSize+h,
+			x+w, y+CubeSize, z-CubeSize,
+			x, y+CubeSize, z-CubeSize,
+		)
+	case FaceBack:
+		nz = -1
+		data.Positions = append(data.Positions,
+			x, y, z-CubeSize,
+			x+w, y, z-CubeSize,
+			x+w, y+h, z-CubeSize,
+			x, y+h, z-CubeSize,
+		)
+	case FaceFront:
+		nz = 1
+		data.Positions = append(data.Positions,
+			x, y, z,
+			x+w, y, z,
+			x+w, y+h, z,
+			x, y+h, z,
+		)
+	}
+
+	data.Normals = append(data.Normals,
+		nx, ny, nz,
+		nx, ny, nz,
+		nx, ny, nz,
+		nx, ny, nz,
+	)
+	addUvs(data, quad.texture.region, w, h, &quad.texture.transform)
+	addLight(data, quad.light)
+	addOcclusion(data, quad.ao)
 	data.IndexCount += 6
 }
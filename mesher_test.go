@@ -0,0 +1,258 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func newTestBank() *BlockBank {
+	bank := NewBlockBank()
+	for i := uint16(1); i <= 3; i++ {
+		top := &TextureRegion{Name: "top"}
+		side := &TextureRegion{Name: "side"}
+		bank.AddType(&BlockType{ID: i, Top: top, Bottom: side, Side: side})
+	}
+	return bank
+}
+
+func fillLayer(chunk *Chunk, y int, t *BlockType) {
+	for x := 0; x < ChunkWidth; x++ {
+		for z := 0; z < ChunkDepth; z++ {
+			chunk.Set(x, y, z, Block(0).ChangeType(t).Activate(true))
+		}
+	}
+}
+
+// quadArea sums up the size of all quads, which is the number of block faces covered
+func quadArea(data *MeshData) int {
+	if data == nil {
+		return 0
+	}
+	area := 0
+	for i := 0; i < len(data.Uvs); i += 8 {
+		// the vertices of a quad might be rotated, so look for the largest uv
+		var w, h float32
+		for j := i; j < i+8; j += 2 {
+			if data.Uvs[j] > w {
+				w = data.Uvs[j]
+			}
+			if data.Uvs[j+1] > h {
+				h = data.Uvs[j+1]
+			}
+		}
+		area += int(w * h)
+	}
+	return area
+}
+
+func TestGreedyMesherFlatLayer(t *testing.T) {
+	bank := newTestBank()
+	chunk := NewChunk(0, 0, 0)
+	fillLayer(chunk, 0, bank.Types[0])
+
+	culled := (&CulledMesher{}).Generate(chunk, bank)
+	greedy := (&GreedyMesher{}).Generate(chunk, bank)
+
+	if culled.IndexCount/6 != 2*ChunkXZ+2*ChunkWidth+2*ChunkDepth {
+		t.Error()
+	}
+	if greedy.IndexCount/6 != 6 {
+		t.Errorf("expected 6 quads, got %v", greedy.IndexCount/6)
+	}
+	if quadArea(greedy) != culled.IndexCount/6 {
+		t.Error()
+	}
+	if len(greedy.Positions) != 12*6 || len(greedy.Regions) != 16*6 || len(greedy.Normals) != 12*6 {
+		t.Error()
+	}
+}
+
+func TestGreedyMesherRandomChunk(t *testing.T) {
+	bank := newTestBank()
+	rnd := rand.New(rand.NewSource(42))
+	chunk := NewChunk(0, 0, 0)
+	for x := 0; x < ChunkWidth; x++ {
+		for y := 0; y < ChunkHeight; y++ {
+			for z := 0; z < ChunkDepth; z++ {
+				chunk.Set(x, y, z, Block(0).ChangeType(bank.Types[rnd.Intn(3)]).Activate(rnd.Intn(2) == 0))
+			}
+		}
+	}
+
+	culled := (&CulledMesher{}).Generate(chunk, bank)
+	greedy := (&GreedyMesher{}).Generate(chunk, bank)
+	if quadArea(greedy) != culled.IndexCount/6 {
+		t.Errorf("greedy covers %v faces, culled %v", quadArea(greedy), culled.IndexCount/6)
+	}
+	if greedy.IndexCount > culled.IndexCount {
+		t.Error()
+	}
+}
+
+func TestGreedyMesherNeighbors(t *testing.T) {
+	bank := newTestBank()
+	chunks := make(map[ChunkPosition]*Chunk)
+	for x := 0; x < 2; x++ {
+		chunk := NewChunk(x, 0, 0)
+		for y := 0; y < ChunkHeight; y++ {
+			fillLayer(chunk, y, bank.Types[1])
+		}
+		chunk.setNeighbors(chunks)
+		chunks[chunk.Position] = chunk
+	}
+
+	// the shared border must not have any faces
+	data := (&GreedyMesher{}).Generate(chunks[ChunkPosition{0, 0, 0}], bank)
+	for i := 0; i < len(data.Normals); i += 3 {
+		if data.Normals[i] == 1 {
+			t.Fatal("found face at chunk border")
+		}
+	}
+	if quadArea(data) != 5*ChunkXZ {
+		t.Error()
+	}
+}
+
+func TestGreedyMesherEmptyChunk(t *testing.T) {
+	if (&GreedyMesher{}).Generate(NewChunk(0, 0, 0), newTestBank()) != nil {
+		t.Error()
+	}
+}
+
+func TestMesherUnknownType(t *testing.T) {
+	bank := newTestBank()
+	chunk := NewChunk(0, 0, 0)
+	fillLayer(chunk, 0, bank.Types[0])
+	chunk.Set(4, 5, 4, Block(9).Activate(true))
+
+	// the block without a type is skipped
+	if culled := (&CulledMesher{}).Generate(chunk, bank); culled.IndexCount/6 != 2*ChunkXZ+2*ChunkWidth+2*ChunkDepth {
+		t.Error(culled.IndexCount / 6)
+	}
+	if greedy := (&GreedyMesher{}).Generate(chunk, bank); greedy.IndexCount/6 != 6 {
+		t.Error(greedy.IndexCount / 6)
+	}
+}
+
+func TestFaceOcclusion(t *testing.T) {
+	bank := newTestBank()
+	chunk := NewChunk(0, 0, 0)
+	block := Block(0).ChangeType(bank.Types[0]).Activate(true)
+	chunk.Set(5, 5, 5, block)
+
+	ao := faceOcclusion(bank, chunk, FaceTop, 5, 5, 5)
+	if ao != [4]uint8{3, 3, 3, 3} {
+		t.Error(ao)
+	}
+
+	// block diagonally above the v0 corner (-x, +z)
+	chunk.Set(4, 6, 6, block)
+	ao = faceOcclusion(bank, chunk, FaceTop, 5, 5, 5)
+	if ao != [4]uint8{2, 3, 3, 3} {
+		t.Error(ao)
+	}
+
+	// both sides of the v0 corner are occluded
+	chunk.Set(4, 6, 5, block)
+	chunk.Set(5, 6, 6, block)
+	ao = faceOcclusion(bank, chunk, FaceTop, 5, 5, 5)
+	if ao[0] != 0 {
+		t.Error(ao)
+	}
+}
+
+func TestFaceOcclusionNeighborChunk(t *testing.T) {
+	bank := newTestBank()
+	chunks := make(map[ChunkPosition]*Chunk)
+	left := NewChunk(-1, 0, 0)
+	chunks[left.Position] = left
+	chunk := NewChunk(0, 0, 0)
+	chunk.setNeighbors(chunks)
+
+	block := Block(0).ChangeType(bank.Types[0]).Activate(true)
+	chunk.Set(0, 0, 5, block)
+	left.Set(ChunkWidth-1, 1, 5, block)
+
+	// v0 & v3 of the top face are at the left side
+	ao := faceOcclusion(bank, chunk, FaceTop, 0, 0, 5)
+	if ao != [4]uint8{2, 3, 3, 2} {
+		t.Error(ao)
+	}
+}
+
+func TestOcclusionFlipsQuad(t *testing.T) {
+	data := &MeshData{}
+	(&CulledMesher{}).addTopFace(0, 0, 0, data, newTestBank().Types[0].faceTexture(0, FaceTop), quadLight{}, [4]uint8{0, 3, 3, 3})
+
+	// the dark corner must not be on the diagonal that splits the quad
+	if data.Occlusion[0] == 0 || data.Occlusion[2] == 0 {
+		t.Error(data.Occlusion)
+	}
+	if data.Occlusion[3] != 0 || data.Positions[9] != 0 || data.Positions[11] != 0 {
+		t.Error(data.Positions)
+	}
+	if len(data.Occlusion) != 4 {
+		t.Error()
+	}
+}
+
+// newTransparentBank adds glass (translucent) & leaves (cutout) to the test bank. The x uv of
+// every texture is the render layer of its type.
+func newTransparentBank() *BlockBank {
+	bank := newTestBank()
+	bank.AddType(&BlockType{ID: 4, Layer: LayerTranslucent})
+	bank.AddType(&BlockType{ID: 5, Layer: LayerCutout})
+	for _, t := range bank.Types {
+		region := &TextureRegion{}
+		region.Uvs[0].X = float32(t.Layer)
+		t.Top, t.Bottom, t.Side = region, region, region
+	}
+	return bank
+}
+
+func TestTransparentFaces(t *testing.T) {
+	bank := newTransparentBank()
+	stone, glass, leaves := bank.Types[0], bank.Types[3], bank.Types[4]
+	chunk := NewChunk(0, 0, 0)
+	chunk.Set(1, 1, 1, Block(0).ChangeType(glass).Activate(true))
+	chunk.Set(2, 1, 1, Block(0).ChangeType(glass).Activate(true))
+	chunk.Set(3, 1, 1, Block(0).ChangeType(stone).Activate(true))
+	chunk.Set(1, 2, 1, Block(0).ChangeType(leaves).Activate(true))
+
+	// no face between the glass blocks & the glass face towards the stone is hidden.
+	// The stone & the leaves show their faces towards the glass.
+	culled := (&CulledMesher{}).Generate(chunk, bank)
+	if culled.LayerIndexCounts != [renderLayerCount]int{6 * 6, 6 * 6, 9 * 6} || culled.IndexCount != 21*6 {
+		t.Error(culled.LayerIndexCounts)
+	}
+
+	greedy := (&GreedyMesher{}).Generate(chunk, bank)
+	if quadArea(greedy) != 21 || greedy.IndexCount != len(greedy.Positions)/2 {
+		t.Error(quadArea(greedy))
+	}
+
+	// the quads are sorted by layer
+	for _, data := range []*MeshData{culled, greedy} {
+		quad := 0
+		for layer, count := range data.LayerIndexCounts {
+			for end := quad + count/6; quad < end; quad++ {
+				if data.Regions[quad*16] != float32(layer) {
+					t.Error(layer, quad)
+				}
+			}
+		}
+	}
+}
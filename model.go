@@ -0,0 +1,408 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// FaceNone is the cull face of model quads, that are never culled.
+const FaceNone = -1
+
+// occlusionGrid is the resolution, with which the covered sides of a model are computed.
+// Boxes should be aligned to 1/16 of a block, like the pixels of a 16x16 texture.
+const occlusionGrid = 16
+
+var faceNames = []string{"left", "right", "bottom", "top", "back", "front"}
+
+// ModelQuad is a quad of a block model. The corners are in block units (0..1) & in the vertex
+// order of the meshers. The uvs are in tile space, 0..1 covers the whole texture.
+type ModelQuad struct {
+	Corners [4][3]float32
+	Uvs     [4][2]float32
+	Normal  [3]float32
+
+	// Texture is the face of the block type, whose texture the quad uses. See BlockType.Faces.
+	Texture int
+	// CullFace is the side of the block the quad lies on. The quad is hidden if the neighbor
+	// on that side covers it. FaceNone for quads inside of the block.
+	CullFace int
+}
+
+// ModelFace is a face of a ModelBox.
+type ModelFace struct {
+	// Texture is the face of the block type, whose texture is used.
+	Texture int
+	// Uvs are u0, v0, u1 & v1 in tile space. If nil, the texture is projected onto the box,
+	// so the faces of adjacent boxes continue the texture like on a cube.
+	Uvs *[4]float32
+}
+
+// ModelBox is an axis aligned box of a block model. From & To are in block units (0..1).
+// Faces, that are nil, are not drawn.
+type ModelBox struct {
+	From, To [3]float32
+	Faces    [6]*ModelFace
+}
+
+// NewModelBox returns a box, whose faces use the texture of the same block face.
+func NewModelBox(from, to [3]float32) ModelBox {
+	box := ModelBox{From: from, To: to}
+	for face := range box.Faces {
+		box.Faces[face] = &ModelFace{Texture: face}
+	}
+	return box
+}
+
+// BlockModel is the shape of a block type. Block types without a model are unit cubes.
+// The model is rotated by the facing & axis property of the block type.
+type BlockModel struct {
+	Quads []ModelQuad
+
+	// the sides of the block, that are completely covered by the model
+	occludes [6]bool
+	// true if the model is the textured unit cube, which is meshed like a block without a model
+	cube bool
+}
+
+// NewBoxModel builds a model out of boxes.
+func NewBoxModel(boxes ...ModelBox) *BlockModel {
+	model := &BlockModel{}
+	for _, box := range boxes {
+		for face, f := range box.Faces {
+			if f != nil {
+				model.Quads = append(model.Quads, box.quad(face, f))
+			}
+		}
+	}
+	model.computeOcclusion()
+
+	if len(boxes) == 1 && boxes[0].From == [3]float32{0, 0, 0} && boxes[0].To == [3]float32{1, 1, 1} {
+		model.cube = true
+		for face, f := range boxes[0].Faces {
+			model.cube = model.cube && f != nil && f.Texture == face && f.Uvs == nil
+		}
+	}
+	return model
+}
+
+// NewCrossModel returns two diagonal planes, like for grass tufts & flowers. Both use the
+// front texture. The normals point up, so both sides of the planes are lit like the ground.
+func NewCrossModel() *BlockModel {
+	uvs := [4][2]float32{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	return &BlockModel{Quads: []ModelQuad{
+		{
+			Corners:  [4][3]float32{{0, 0, 0}, {1, 0, 1}, {1, 1, 1}, {0, 1, 0}},
+			Uvs:      uvs,
+			Normal:   [3]float32{0, 1, 0},
+			Texture:  FaceFront,
+			CullFace: FaceNone,
+		},
+		{
+			Corners:  [4][3]float32{{0, 0, 1}, {1, 0, 0}, {1, 1, 0}, {0, 1, 1}},
+			Uvs:      uvs,
+			Normal:   [3]float32{0, 1, 0},
+			Texture:  FaceFront,
+			CullFace: FaceNone,
+		},
+	}}
+}
+
+// NewSlabModel returns the bottom or top half of a cube.
+func NewSlabModel(half Half) *BlockModel {
+	if half == HalfTop {
+		return NewBoxModel(NewModelBox([3]float32{0, 0.5, 0}, [3]float32{1, 1, 1}))
+	}
+	return NewBoxModel(NewModelBox([3]float32{0, 0, 0}, [3]float32{1, 0.5, 1}))
+}
+
+// NewStairModel returns a bottom slab with a step on the back half. The step is on the north
+// side, so the stair faces the direction of its facing property.
+func NewStairModel() *BlockModel {
+	return NewBoxModel(
+		NewModelBox([3]float32{0, 0, 0}, [3]float32{1, 0.5, 1}),
+		NewModelBox([3]float32{0, 0.5, 0}, [3]float32{1, 1, 0.5}),
+	)
+}
+
+// quad returns the quad of the given box face.
+func (b *ModelBox) quad(face int, f *ModelFace) ModelQuad {
+	q := ModelQuad{Texture: f.Texture, CullFace: FaceNone}
+	d := faceAxes[face][0]
+	n := faceNormal(face)
+	q.Normal = [3]float32{float32(n[0]), float32(n[1]), float32(n[2])}
+
+	// the plane of the face & whether it is on the side of the block
+	plane := b.From[d]
+	if faceDirections[face] > 0 {
+		plane = b.To[d]
+	}
+	if plane == float32((faceDirections[face]+1)/2) {
+		q.CullFace = face
+	}
+
+	// the vertices in the order (0, 0), (1, 0), (1, 1), (0, 1) along the u & v axis of the face
+	for i, c := range [4][2]int{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+		q.Corners[i][d] = plane
+		for k, frame := range faceFrames[face] {
+			axis, dir := frameAxis(frame)
+			if (c[k] == 1) == (dir > 0) {
+				q.Corners[i][axis] = b.To[axis]
+			} else {
+				q.Corners[i][axis] = b.From[axis]
+			}
+			if f.Uvs != nil {
+				q.Uvs[i][k] = f.Uvs[k+2*c[k]]
+			} else if dir > 0 {
+				q.Uvs[i][k] = q.Corners[i][axis]
+			} else {
+				q.Uvs[i][k] = 1 - q.Corners[i][axis]
+			}
+		}
+	}
+	return q
+}
+
+// frameAxis returns the axis & direction of a texture frame vector.
+func frameAxis(v [3]int) (axis, dir int) {
+	for axis, d := range v {
+		if d != 0 {
+			return axis, d
+		}
+	}
+	return 0, 1
+}
+
+// computeOcclusion checks which sides of the block are completely covered by the quads on them.
+func (m *BlockModel) computeOcclusion() {
+	for face := range m.occludes {
+		var covered [occlusionGrid * occlusionGrid]bool
+		u, v := faceAxes[face][1], faceAxes[face][2]
+		for _, q := range m.Quads {
+			if q.CullFace != face {
+				continue
+			}
+			minU, maxU := q.Corners[0][u], q.Corners[2][u]
+			minV, maxV := q.Corners[0][v], q.Corners[2][v]
+			if minU > maxU {
+				minU, maxU = maxU, minU
+			}
+			if minV > maxV {
+				minV, maxV = maxV, minV
+			}
+			for i := range covered {
+				cu := (float32(i%occlusionGrid) + 0.5) / occlusionGrid
+				cv := (float32(i/occlusionGrid) + 0.5) / occlusionGrid
+				if cu > minU && cu < maxU && cv > minV && cv < maxV {
+					covered[i] = true
+				}
+			}
+		}
+
+		m.occludes[face] = true
+		for _, c := range covered {
+			m.occludes[face] = m.occludes[face] && c
+		}
+	}
+}
+
+// isCube returns true if the blocks of the type are unit cubes.
+func (t *BlockType) isCube() bool {
+	return t.Model == nil || t.Model.cube
+}
+
+// occludes returns true if the block completely covers the given side.
+func (t *BlockType) occludes(block Block, face int) bool {
+	if t.isCube() {
+		return true
+	}
+	if faces := t.orientedFaces(block); faces != nil {
+		face = faces[face].face
+	}
+	return t.Model.occludes[face]
+}
+
+// addModel adds the quads of the model of the block at the chunk coordinates x, y, z.
+// xx, yy, zz are the world coordinates of the block, like in the meshers. Quads on the sides
+// of the block are skipped, if the neighbor covers them. Models get no ambient occlusion.
+func addModel(data *MeshData, bank *BlockBank, chunk *Chunk, block Block, x, y, z int, xx, yy, zz float32) {
+	blockType := bank.TypeOf(block)
+	r := rotations[0][0]
+	if f, a, ok := blockType.orientation(block); ok {
+		r = rotations[f][a]
+	}
+
+	// models are lit by the light inside of the block
+	light := flatLight(lightAt(chunk, x, y, z))
+
+	for i := range blockType.Model.Quads {
+		q := &blockType.Model.Quads[i]
+		if q.CullFace != FaceNone {
+			face := faceOf(r.apply(faceNormal(q.CullFace)))
+			if !faceVisible(bank, blockType, chunk, face, x, y, z) {
+				continue
+			}
+		}
+
+		// rotate around the center of the block. The blocks span z-1..z in world space.
+		for _, c := range q.Corners {
+			p := r.applyf([3]float32{c[0] - 0.5, c[1] - 0.5, c[2] - 0.5})
+			data.Positions = append(data.Positions, xx+p[0]+0.5, yy+p[1]+0.5, zz+p[2]-0.5)
+		}
+		n := r.applyf(q.Normal)
+		data.Normals = append(data.Normals,
+			n[0], n[1], n[2],
+			n[0], n[1], n[2],
+			n[0], n[1], n[2],
+			n[0], n[1], n[2],
+		)
+		for _, uv := range q.Uvs {
+			data.Uvs = append(data.Uvs, uv[0], uv[1])
+		}
+		addRegion(data, blockType.faceRegion(q.Texture))
+		addLight(data, light)
+		addOcclusion(data, [4]uint8{3, 3, 3, 3})
+		data.IndexCount += 6
+	}
+}
+
+func (r rotation) applyf(v [3]float32) [3]float32 {
+	var out [3]float32
+	for i := 0; i < 3; i++ {
+		out[i] = float32(r[i][0])*v[0] + float32(r[i][1])*v[1] + float32(r[i][2])*v[2]
+	}
+	return out
+}
+
+// ----------------------------------------------------------------------------
+
+// blockModelJSON is the file format of block models. Type is cube, cross, slab, stair or
+// boxes. Half is bottom or top for slabs.
+type blockModelJSON struct {
+	Type  string         `json:"type"`
+	Half  string         `json:"half"`
+	Boxes []modelBoxJSON `json:"boxes"`
+}
+
+// modelBoxJSON is a box of a model. If faces is missing, all faces are drawn with their own
+// texture. Otherwise only the listed faces are drawn.
+type modelBoxJSON struct {
+	From  [3]float32                `json:"from"`
+	To    [3]float32                `json:"to"`
+	Faces map[string]*modelFaceJSON `json:"faces"`
+}
+
+// modelFaceJSON is a face of a box. Texture is the name of the block face, whose texture is
+// used. It defaults to the face itself.
+type modelFaceJSON struct {
+	Texture string      `json:"texture"`
+	Uvs     *[4]float32 `json:"uvs"`
+}
+
+// LoadBlockModel reads the block model at the given path.
+func LoadBlockModel(path string) (*BlockModel, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBlockModel(data)
+}
+
+// ParseBlockModel parses a block model, like
+//
+//	{"type": "boxes", "boxes": [{"from": [0.375, 0, 0.375], "to": [0.625, 1, 0.625]}]}
+//
+// for a fence post. Unknown fields are an error.
+func ParseBlockModel(data []byte) (*BlockModel, error) {
+	config := &blockModelJSON{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("vox: failed to parse block model: %v", err)
+	}
+
+	switch config.Type {
+	case "cube":
+		return NewBoxModel(NewModelBox([3]float32{0, 0, 0}, [3]float32{1, 1, 1})), nil
+	case "cross":
+		return NewCrossModel(), nil
+	case "stair":
+		return NewStairModel(), nil
+	case "slab":
+		switch config.Half {
+		case "", "bottom":
+			return NewSlabModel(HalfBottom), nil
+		case "top":
+			return NewSlabModel(HalfTop), nil
+		}
+		return nil, fmt.Errorf("vox: invalid block model: unknown half %q", config.Half)
+	case "boxes":
+		if len(config.Boxes) == 0 {
+			return nil, fmt.Errorf("vox: invalid block model: at least one box is needed")
+		}
+		boxes := make([]ModelBox, len(config.Boxes))
+		for i := range config.Boxes {
+			box, err := config.Boxes[i].build()
+			if err != nil {
+				return nil, fmt.Errorf("vox: invalid block model: box %v: %v", i, err)
+			}
+			boxes[i] = box
+		}
+		return NewBoxModel(boxes...), nil
+	}
+	return nil, fmt.Errorf("vox: invalid block model: unknown type %q", config.Type)
+}
+
+func (b *modelBoxJSON) build() (ModelBox, error) {
+	for i := range b.From {
+		if b.From[i] < 0 || b.To[i] > 1 || b.From[i] >= b.To[i] {
+			return ModelBox{}, fmt.Errorf("from %v & to %v must be within 0..1 & from < to", b.From, b.To)
+		}
+	}
+	if b.Faces == nil {
+		return NewModelBox(b.From, b.To), nil
+	}
+
+	box := ModelBox{From: b.From, To: b.To}
+	for name, f := range b.Faces {
+		face := faceIndex(name)
+		if face == FaceNone {
+			return box, fmt.Errorf("unknown face %q", name)
+		}
+		texture := face
+		if f != nil && f.Texture != "" {
+			if texture = faceIndex(f.Texture); texture == FaceNone {
+				return box, fmt.Errorf("face %v: unknown texture %q", name, f.Texture)
+			}
+		}
+		box.Faces[face] = &ModelFace{Texture: texture}
+		if f != nil {
+			box.Faces[face].Uvs = f.Uvs
+		}
+	}
+	return box, nil
+}
+
+// faceIndex returns the face with the given name or FaceNone.
+func faceIndex(name string) int {
+	for i, n := range faceNames {
+		if n == name {
+			return i
+		}
+	}
+	return FaceNone
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"testing"
+)
+
+// newModelBank adds a slab, a stair with a facing & a flower to the test bank
+func newModelBank() (*BlockBank, *FacingProperty) {
+	bank := newTestBank()
+	region := bank.Types[0].Side
+	bank.AddType(&BlockType{ID: 4, Top: region, Bottom: region, Side: region, Model: NewSlabModel(HalfBottom)})
+	stair := &BlockType{ID: 5, Top: region, Bottom: region, Side: region, Model: NewStairModel()}
+	facing := NewFacingProperty()
+	stair.AddProperty(facing.Property)
+	bank.AddType(stair)
+	bank.AddType(&BlockType{ID: 6, Layer: LayerCutout, Side: region, Model: NewCrossModel()})
+	return bank, facing
+}
+
+func TestModelOcclusion(t *testing.T) {
+	cases := []struct {
+		model    *BlockModel
+		occludes [6]bool
+	}{
+		{NewBoxModel(NewModelBox([3]float32{0, 0, 0}, [3]float32{1, 1, 1})), [6]bool{true, true, true, true, true, true}},
+		{NewSlabModel(HalfBottom), [6]bool{FaceBottom: true}},
+		{NewSlabModel(HalfTop), [6]bool{FaceTop: true}},
+		{NewStairModel(), [6]bool{FaceBottom: true, FaceBack: true}},
+		{NewCrossModel(), [6]bool{}},
+	}
+	for i, c := range cases {
+		if c.model.occludes != c.occludes {
+			t.Error(i, c.model.occludes)
+		}
+	}
+
+	if !cases[0].model.cube || cases[1].model.cube {
+		t.Error()
+	}
+}
+
+func TestModelBoxQuads(t *testing.T) {
+	model := NewSlabModel(HalfTop)
+	if len(model.Quads) != 6 {
+		t.Fatal(len(model.Quads))
+	}
+
+	// the bottom is the only face inside of the block
+	for _, q := range model.Quads {
+		if (q.Texture == FaceBottom) != (q.CullFace == FaceNone) || (q.CullFace != FaceNone && q.CullFace != q.Texture) {
+			t.Error(q.Texture, q.CullFace)
+		}
+	}
+
+	// the side texture is projected, so the upper half of the texture is used
+	left := model.Quads[FaceLeft]
+	if left.Corners[0] != [3]float32{0, 0.5, 0} || left.Uvs[0] != [2]float32{0, 0.5} || left.Uvs[2] != [2]float32{1, 1} {
+		t.Error(left.Corners, left.Uvs)
+	}
+}
+
+func TestModelRotation(t *testing.T) {
+	bank, facing := newModelBank()
+	stair := bank.Types[4]
+	block := Block(0).ChangeType(stair).Activate(true)
+
+	if !stair.occludes(block, FaceBack) || stair.occludes(block, FaceRight) {
+		t.Error()
+	}
+	east := facing.Set(block, FacingEast)
+	if stair.occludes(east, FaceBack) || !stair.occludes(east, FaceRight) || !stair.occludes(east, FaceBottom) {
+		t.Error()
+	}
+
+	// the step of a stair facing east is on the east half of the block
+	chunk := NewChunk(0, 0, 0)
+	chunk.Set(0, 0, 1, east)
+	data := (&CulledMesher{}).Generate(chunk, bank)
+	for i := 0; i < len(data.Positions); i += 3 {
+		x, y := data.Positions[i], data.Positions[i+1]
+		if y > 0.5 && x < 0.5 {
+			t.Fatal(data.Positions[i : i+3])
+		}
+	}
+}
+
+func TestModelCulling(t *testing.T) {
+	bank, _ := newModelBank()
+	stone, slab, flower := bank.Types[0], bank.Types[3], bank.Types[5]
+	chunk := NewChunk(0, 0, 0)
+	chunk.Set(1, 1, 1, Block(0).ChangeType(stone).Activate(true))
+	chunk.Set(1, 2, 1, Block(0).ChangeType(slab).Activate(true))
+	chunk.Set(2, 2, 1, Block(0).ChangeType(stone).Activate(true))
+	chunk.Set(2, 3, 1, Block(0).ChangeType(flower).Activate(true))
+
+	// the stone below the slab & the slab bottom hide each other. The slab doesn't hide the
+	// side of the stone next to it & the flower hides nothing.
+	for _, mesher := range []Mesher{&CulledMesher{}, &GreedyMesher{}} {
+		data := mesher.Generate(chunk, bank)
+		if quads := data.IndexCount / 6; quads != 5+4+6+2 {
+			t.Errorf("%T %v", mesher, quads)
+		}
+		if data.LayerIndexCounts[LayerCutout] != 2*6 {
+			t.Error(data.LayerIndexCounts)
+		}
+	}
+}
+
+func TestParseBlockModel(t *testing.T) {
+	model, err := ParseBlockModel([]byte(`{"type": "boxes", "boxes": [
+		{"from": [0.375, 0, 0.375], "to": [0.625, 1, 0.625]},
+		{"from": [0, 0.75, 0.4375], "to": [1, 0.875, 0.5625], "faces": {
+			"top": {"texture": "bottom", "uvs": [0, 0, 1, 0.125]}, "left": {}
+		}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(model.Quads) != 8 || model.occludes != [6]bool{} {
+		t.Error(len(model.Quads), model.occludes)
+	}
+	// the faces of a box are in face order
+	if model.Quads[6].Texture != FaceLeft || model.Quads[6].CullFace != FaceLeft {
+		t.Error()
+	}
+	rail := model.Quads[7]
+	if rail.Texture != FaceBottom || rail.CullFace != FaceNone || rail.Uvs[2] != [2]float32{1, 0.125} {
+		t.Error(rail.Texture, rail.Uvs)
+	}
+
+	for _, json := range []string{`{"type": "cross"}`, `{"type": "slab", "half": "top"}`, `{"type": "stair"}`, `{"type": "cube"}`} {
+		if _, err := ParseBlockModel([]byte(json)); err != nil {
+			t.Error(json, err)
+		}
+	}
+	invalid := []string{
+		`{"type": "sphere"}`,
+		`{"type": "slab", "half": "left"}`,
+		`{"type": "boxes"}`,
+		`{"type": "boxes", "boxes": [{"from": [0, 0, 0], "to": [1, 2, 1]}]}`,
+		`{"type": "boxes", "boxes": [{"from": [0, 0, 0], "to": [1, 1, 1], "faces": {"up": {}}}]}`,
+		`{"type": "boxes", "boxes": [{"from": [0, 0, 0], "to": [1, 1, 1], "faces": {"top": {"texture": "grass"}}}]}`,
+		`{"type": "cube", "size": 1}`,
+	}
+	for _, json := range invalid {
+		if _, err := ParseBlockModel([]byte(json)); err == nil {
+			t.Error(json)
+		}
+	}
+}
+
+func TestModelChunkIndices(t *testing.T) {
+	// four posts per block, none of their faces are culled
+	bank := newTestBank()
+	region := bank.Types[0].Side
+	var posts []ModelBox
+	for i := 0; i < 4; i++ {
+		x := float32(i%2) * 0.5
+		z := float32(i/2) * 0.5
+		posts = append(posts, NewModelBox([3]float32{x + 0.1, 0, z + 0.1}, [3]float32{x + 0.4, 1, z + 0.4}))
+	}
+	bank.AddType(&BlockType{ID: 4, Top: region, Bottom: region, Side: region, Model: NewBoxModel(posts...)})
+	chunk := NewChunk(0, 0, 0)
+	for y := 0; y < ChunkHeight; y++ {
+		fillLayer(chunk, y, bank.Types[3])
+	}
+
+	data := (&CulledMesher{}).Generate(chunk, bank)
+	quads := data.IndexCount / 6
+	vertices := len(data.Positions) / 3
+	if quads != ChunkXYZ*4*6 || vertices != quads*4 {
+		t.Fatal(quads, vertices)
+	}
+
+	// more vertices than 16 bit indices can address
+	indices := chunkIndices(quads)
+	if vertices <= 1<<16 || len(indices) != data.IndexCount || indices[len(indices)-3] != uint32(vertices-2) {
+		t.Error(vertices, len(indices))
+	}
+	for _, i := range indices {
+		if int(i) >= vertices {
+			t.Fatal(i)
+		}
+	}
+}
+
+func TestModelsDontOcclude(t *testing.T) {
+	bank, _ := newModelBank()
+	glass := &BlockType{ID: 7, Layer: LayerTranslucent}
+	bank.AddType(glass)
+	bank.AddType(&BlockType{ID: 8, Light: 14})
+	stone, slab, flower := bank.Types[0], bank.Types[3], bank.Types[5]
+
+	chunk := NewChunk(0, 0, 0)
+	fillLayer(chunk, 0, stone)
+	chunk.Set(8, 1, 8, Block(0).ChangeType(bank.Types[7]).Activate(true))
+	engine := newLightEngine(bank)
+	engine.addChunk(chunk)
+	want := faceLight(bank, chunk, FaceTop, 5, 0, 8, true)
+
+	// sprites, slabs & glass next to the face neither darken its corners nor block the light
+	for _, blockType := range []*BlockType{flower, slab, glass} {
+		chunk.Set(4, 1, 8, Block(0).ChangeType(blockType).Activate(true))
+		chunk.Set(5, 1, 9, Block(0).ChangeType(blockType).Activate(true))
+		engine.update(chunk, 4, 1, 8)
+		engine.update(chunk, 5, 1, 9)
+		if ao := faceOcclusion(bank, chunk, FaceTop, 5, 0, 8); ao != [4]uint8{3, 3, 3, 3} {
+			t.Error(blockType.ID, ao)
+		}
+		if light := faceLight(bank, chunk, FaceTop, 5, 0, 8, true); light != want {
+			t.Error(blockType.ID, light, want)
+		}
+	}
+
+	chunk.Set(4, 1, 8, Block(0).ChangeType(stone).Activate(true))
+	if ao := faceOcclusion(bank, chunk, FaceTop, 5, 0, 8); ao == [4]uint8{3, 3, 3, 3} {
+		t.Error(ao)
+	}
+}
@@ -41,3 +41,18 @@ func (s *SimplexNoise) Simplex2(x, y float64, octaves int, persistence, lacunari
 
 	return (1 + total/max) / 2
 }
+
+func (s *SimplexNoise) Simplex3(x, y, z float64, octaves int, persistence, lacunarity float64) float64 {
+	var freq float64 = 1
+	var amp float64 = 1
+	var max float64 = 1
+	total := s.noise.Eval3(x, y, z)
+	for i := 1; i < octaves; i++ {
+		freq *= lacunarity
+		amp *= persistence
+		max += amp
+		total += s.noise.Eval3(x*freq, y*freq, z*freq) * amp
+	}
+
+	return (1 + total/max) / 2
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import "math/rand"
+
+// Ore places veins of a block into a host block.
+type Ore struct {
+	Block   uint16
+	Replace uint16
+	// Count is the number of veins per chunk, that overlaps the depth range
+	Count int
+	// Size is the number of steps of the random walk of a vein, so the maximum number of blocks
+	Size int
+	// ores are only placed between MinY and MaxY (world y, exclusive)
+	MinY int
+	MaxY int
+}
+
+// Place places the veins of the ore into the chunk. The veins are clipped at the chunk borders
+// & the depth range.
+func (o *Ore) Place(c *Chunk, rnd *rand.Rand) {
+	baseY := c.Position.Y * ChunkHeight
+	minY := clampInt(o.MinY-baseY, 0, ChunkHeight)
+	maxY := clampInt(o.MaxY-baseY, 0, ChunkHeight)
+	if minY >= maxY {
+		return
+	}
+
+	block := Block(o.Block).Activate(true)
+	size := o.Size
+	if size < 1 {
+		size = 1
+	}
+	for i := 0; i < o.Count; i++ {
+		x := rnd.Intn(ChunkWidth)
+		y := minY + rnd.Intn(maxY-minY)
+		z := rnd.Intn(ChunkDepth)
+		for step := 0; step < size; step++ {
+			if x >= 0 && z >= 0 && x < ChunkWidth && z < ChunkDepth && y >= minY && y < maxY {
+				if old := c.Get(x, y, z); old.Active() && old.TypeID() == o.Replace {
+					c.Set(x, y, z, block)
+				}
+			}
+
+			// walk along a random axis
+			d := 1 - 2*rnd.Intn(2)
+			switch rnd.Intn(3) {
+			case 0:
+				x += d
+			case 1:
+				y += d
+			default:
+				z += d
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import "testing"
+
+func TestOreDistribution(t *testing.T) {
+	ore := &Ore{Block: 3, Replace: 1, Count: 4, Size: 8, MinY: -16, MaxY: 16}
+	gen := NewPipelineGenerator(16726, Stage{"host", func(c *Chunk, ctx *GenContext) {
+		for i := 0; i < ChunkXYZ; i++ {
+			c.blocks.Set(i, Block(1).Activate(true))
+		}
+	}}, OreStage(ore))
+
+	// 1000 chunks, 200 of them in the depth range
+	var total, inRange, withOre int
+	var columns [ChunkXZ]int
+	for x := 0; x < 10; x++ {
+		for y := -5; y < 5; y++ {
+			for z := 0; z < 10; z++ {
+				c := gen.GenerateChunkAt(x, y, z, nil)
+				count := 0
+				for i := 0; i < ChunkXYZ; i++ {
+					b := c.blocks.Get(i)
+					if b.TypeID() != 3 {
+						continue
+					}
+					count++
+					columns[i%ChunkXZ]++
+					wy := y*ChunkHeight + i/ChunkXZ
+					if wy < ore.MinY || wy >= ore.MaxY {
+						t.Fatalf("ore at y %v", wy)
+					}
+				}
+				if y == -1 || y == 0 {
+					inRange++
+					if count > 0 {
+						withOre++
+					}
+				} else if count > 0 {
+					t.Fatal("ore outside of the depth range")
+				}
+				if count > ore.Count*ore.Size {
+					t.Fatalf("%v ores in a chunk", count)
+				}
+				total += count
+			}
+		}
+	}
+
+	// every chunk in range gets veins, the walks overlap themselves a bit
+	mean := float64(total) / float64(inRange)
+	if withOre != inRange || mean < 0.4*float64(ore.Count*ore.Size) {
+		t.Errorf("%v of %v chunks have ores, %v per chunk", withOre, inRange, mean)
+	}
+
+	// the veins are spread over the whole chunk
+	expected := float64(total) / ChunkXZ
+	for i, n := range columns {
+		if float64(n) < 0.3*expected || float64(n) > 2*expected {
+			t.Errorf("column %v has %v ores, expected about %v", i, n, expected)
+		}
+	}
+}
+
+func TestOreHost(t *testing.T) {
+	// only the host block is replaced
+	c := NewChunk(0, 0, 0)
+	for i := 0; i < ChunkXYZ; i++ {
+		c.blocks.Set(i, Block(1+i%2).Activate(true))
+	}
+	ore := &Ore{Block: 3, Replace: 1, Count: 50, Size: 10, MinY: 0, MaxY: 16}
+	ore.Place(c, NewChunkRand(1, 0, 0, 0))
+
+	ores := 0
+	for i := 0; i < ChunkXYZ; i++ {
+		switch c.blocks.Get(i).TypeID() {
+		case 2:
+			if i%2 != 1 {
+				t.Fatal()
+			}
+		case 3:
+			ores++
+			if i%2 != 0 {
+				t.Fatal("ore replaced the wrong block")
+			}
+		}
+	}
+	if ores == 0 {
+		t.Error()
+	}
+}
+
+func TestSimplexOres(t *testing.T) {
+	checkDeterministic(t, func() Generator {
+		gen := newBiomeGenerator()
+		gen.Ores = []*Ore{{Block: 3, Replace: 1, Count: 8, Size: 6, MinY: -32, MaxY: 32}}
+		return gen
+	})
+}
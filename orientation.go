@@ -0,0 +1,251 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import "github.com/mbrlabs/vox/glm"
+
+// uvTransform maps the tile coordinates of a world face to the tile coordinates of the
+// texture: u' = t[0]*u + t[1]*v, v' = t[2]*u + t[3]*v. It rotates or mirrors the texture
+// in steps of 90 degrees.
+type uvTransform [4]int8
+
+var identityUv = uvTransform{1, 0, 0, 1}
+
+// faceTexture is the texture of a world face of an oriented block.
+type faceTexture struct {
+	region    *TextureRegion
+	transform uvTransform
+}
+
+// orientedFace is the model face, that is visible on a world face, and how its texture
+// has to be rotated.
+type orientedFace struct {
+	face      int
+	transform uvTransform
+}
+
+// rotation is a 3x3 rotation matrix with integer entries, that maps model to world space.
+type rotation [3][3]int
+
+// The model of a block faces north (-z) with its top up (+y). The facing rotates the front of
+// the model, the axis rotates its y axis.
+var (
+	facingRotations = [6]rotation{
+		FacingNorth: {{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+		FacingEast:  {{0, 0, -1}, {0, 1, 0}, {1, 0, 0}},
+		FacingSouth: {{-1, 0, 0}, {0, 1, 0}, {0, 0, -1}},
+		FacingWest:  {{0, 0, 1}, {0, 1, 0}, {-1, 0, 0}},
+		FacingUp:    {{1, 0, 0}, {0, 0, -1}, {0, 1, 0}},
+		FacingDown:  {{1, 0, 0}, {0, 0, 1}, {0, -1, 0}},
+	}
+	axisRotations = [3]rotation{
+		AxisY: {{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+		AxisX: {{0, 1, 0}, {-1, 0, 0}, {0, 0, 1}},
+		AxisZ: {{1, 0, 0}, {0, 0, -1}, {0, 1, 0}},
+	}
+)
+
+// the texture u & v direction of every face. They match the uvs the meshers emit for an
+// unrotated block.
+var faceFrames = [6][2][3]int{
+	FaceLeft:   {{0, 0, 1}, {0, 1, 0}},
+	FaceRight:  {{0, 0, -1}, {0, 1, 0}},
+	FaceBottom: {{1, 0, 0}, {0, 0, -1}},
+	FaceTop:    {{1, 0, 0}, {0, 0, -1}},
+	FaceBack:   {{1, 0, 0}, {0, 1, 0}},
+	FaceFront:  {{1, 0, 0}, {0, 1, 0}},
+}
+
+// orientations holds the faces & rotations of every facing & axis combination
+var (
+	orientations [6][3][6]orientedFace
+	rotations    [6][3]rotation
+)
+
+func init() {
+	for f := range facingRotations {
+		for a := range axisRotations {
+			r := facingRotations[f].mul(axisRotations[a])
+			rotations[f][a] = r
+			for face := range orientations[f][a] {
+				model := faceOf(r.transposed().apply(faceNormal(face)))
+				u := r.apply(faceFrames[model][0])
+				v := r.apply(faceFrames[model][1])
+				fu, fv := faceFrames[face][0], faceFrames[face][1]
+				orientations[f][a][face] = orientedFace{
+					face:      model,
+					transform: uvTransform{dot(fu, u), dot(fv, u), dot(fu, v), dot(fv, v)},
+				}
+			}
+		}
+	}
+}
+
+func (r rotation) mul(o rotation) rotation {
+	var m rotation
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += r[i][k] * o[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func (r rotation) transposed() rotation {
+	var m rotation
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			m[i][j] = r[j][i]
+		}
+	}
+	return m
+}
+
+func (r rotation) apply(v [3]int) [3]int {
+	var out [3]int
+	for i := 0; i < 3; i++ {
+		out[i] = r[i][0]*v[0] + r[i][1]*v[1] + r[i][2]*v[2]
+	}
+	return out
+}
+
+func dot(a, b [3]int) int8 {
+	return int8(a[0]*b[0] + a[1]*b[1] + a[2]*b[2])
+}
+
+// faceNormal returns the outward normal of a face.
+func faceNormal(face int) [3]int {
+	var n [3]int
+	n[faceAxes[face][0]] = faceDirections[face]
+	return n
+}
+
+// faceOf returns the face with the given axis aligned normal.
+func faceOf(n [3]int) int {
+	for axis, d := range n {
+		if d != 0 {
+			return axis*2 + (d+1)/2
+		}
+	}
+	return FaceTop
+}
+
+// orientation returns the facing & axis index of the block. ok is false if the block type
+// can't be rotated.
+func (t *BlockType) orientation(block Block) (f, a int, ok bool) {
+	if t.facing == nil && t.axis == nil {
+		return 0, 0, false
+	}
+	if t.facing != nil {
+		f = t.facing.Index(block)
+	}
+	if t.axis != nil {
+		a = t.axis.Index(block)
+	}
+	if f >= len(facingRotations) || a >= len(axisRotations) {
+		return 0, 0, false
+	}
+	return f, a, true
+}
+
+// orientedFaces returns the faces of a block in the orientation of its facing & axis property,
+// or nil if the block type can't be rotated.
+func (t *BlockType) orientedFaces(block Block) *[6]orientedFace {
+	if f, a, ok := t.orientation(block); ok {
+		return &orientations[f][a]
+	}
+	return nil
+}
+
+// faceTexture returns the texture of a world face of the block. The meshers use it instead of
+// faceRegion, so oriented blocks show the right texture.
+func (t *BlockType) faceTexture(block Block, face int) faceTexture {
+	if faces := t.orientedFaces(block); faces != nil {
+		f := &faces[face]
+		return faceTexture{t.faceRegion(f.face), f.transform}
+	}
+	return faceTexture{t.faceRegion(face), identityUv}
+}
+
+// ----------------------------------------------------------------------------
+
+// FacingOf returns the direction of the normal of a face.
+func FacingOf(face int) Facing {
+	switch face {
+	case FaceLeft:
+		return FacingWest
+	case FaceRight:
+		return FacingEast
+	case FaceBottom:
+		return FacingDown
+	case FaceTop:
+		return FacingUp
+	case FaceBack:
+		return FacingNorth
+	}
+	return FacingSouth
+}
+
+// AxisOf returns the axis of the normal of a face.
+func AxisOf(face int) Axis {
+	switch faceAxes[face][0] {
+	case 0:
+		return AxisX
+	case 2:
+		return AxisZ
+	}
+	return AxisY
+}
+
+// Orient sets the facing & axis property of a block, that is placed against the given face of
+// another block. look is the view direction of the player. The axis follows the normal of the
+// clicked face, so logs stick out of the surface they are placed on. The facing points back at
+// the player: along the face normal for side faces and along the horizontal view direction
+// if the top or bottom was clicked. Block types without these properties are returned unchanged.
+func (t *BlockType) Orient(block Block, face int, look *glm.Vector3) Block {
+	if t.axis != nil {
+		block = t.axis.WithIndex(block, int(AxisOf(face)))
+	}
+	if t.facing != nil {
+		facing := FacingOf(face)
+		if face == FaceTop || face == FaceBottom {
+			facing = facingTowards(look)
+		}
+		block = t.facing.WithIndex(block, int(facing))
+	}
+	return block
+}
+
+// facingTowards returns the horizontal direction, that points against the view direction.
+func facingTowards(look *glm.Vector3) Facing {
+	if abs32(look.X) > abs32(look.Z) {
+		if look.X > 0 {
+			return FacingWest
+		}
+		return FacingEast
+	}
+	if look.Z > 0 {
+		return FacingNorth
+	}
+	return FacingSouth
+}
+
+func abs32(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
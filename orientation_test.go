@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"testing"
+
+	"github.com/mbrlabs/vox/glm"
+)
+
+func newLogType() (*BlockType, *AxisProperty) {
+	log := &BlockType{ID: 1, Top: &TextureRegion{Name: "rings"}, Side: &TextureRegion{Name: "bark"}}
+	log.Bottom = log.Top
+	axis := NewAxisProperty()
+	log.AddProperty(axis.Property)
+	return log, axis
+}
+
+func newFurnaceType() (*BlockType, *FacingProperty) {
+	side := &TextureRegion{Name: "side"}
+	furnace := &BlockType{ID: 2, Top: side, Bottom: side, Side: side}
+	furnace.Faces[FaceBack] = &TextureRegion{Name: "front"}
+	facing := NewFacingProperty()
+	furnace.AddProperty(facing.Property)
+	return furnace, facing
+}
+
+func TestBlockFaces(t *testing.T) {
+	furnace, _ := newFurnaceType()
+	block := Block(0).ChangeType(furnace)
+	for face := FaceLeft; face <= FaceFront; face++ {
+		name := furnace.faceTexture(block, face).region.Name
+		if (face == FaceBack) != (name == "front") {
+			t.Error(face, name)
+		}
+	}
+}
+
+func TestOrientationTable(t *testing.T) {
+	for f := range orientations {
+		for a := range orientations[f] {
+			seen := make(map[int]bool)
+			for face, o := range orientations[f][a] {
+				seen[o.face] = true
+
+				// the texture is only rotated or mirrored
+				tr := o.transform
+				det := int(tr[0])*int(tr[3]) - int(tr[1])*int(tr[2])
+				if det != 1 && det != -1 {
+					t.Error(f, a, face, tr)
+				}
+			}
+			if len(seen) != 6 {
+				t.Error(f, a, "model faces are not a permutation")
+			}
+		}
+	}
+
+	if orientations[FacingNorth][AxisY] != orientations[0][0] || orientations[0][0][FaceTop].transform != identityUv {
+		t.Error()
+	}
+}
+
+func TestOrientedLog(t *testing.T) {
+	log, axis := newLogType()
+	block := Block(0).ChangeType(log)
+
+	cases := map[Axis][2]int{AxisY: {FaceBottom, FaceTop}, AxisX: {FaceLeft, FaceRight}, AxisZ: {FaceBack, FaceFront}}
+	for a, ends := range cases {
+		b := axis.Set(block, a)
+		for face := FaceLeft; face <= FaceFront; face++ {
+			name := log.faceTexture(b, face).region.Name
+			if (face == ends[0] || face == ends[1]) != (name == "rings") {
+				t.Error(a, face, name)
+			}
+		}
+	}
+
+	// the bark of a log along x runs along x: the texture v axis follows the world u axis
+	tr := log.faceTexture(axis.Set(block, AxisX), FaceTop).transform
+	if tr[2] == 0 || tr[3] != 0 {
+		t.Error(tr)
+	}
+}
+
+func TestOrientedFurnace(t *testing.T) {
+	furnace, facing := newFurnaceType()
+	block := Block(0).ChangeType(furnace)
+
+	for f := FacingNorth; f <= FacingDown; f++ {
+		b := facing.Set(block, f)
+		for face := FaceLeft; face <= FaceFront; face++ {
+			name := furnace.faceTexture(b, face).region.Name
+			if (FacingOf(face) == f) != (name == "front") {
+				t.Error(f, face, name)
+			}
+		}
+	}
+}
+
+func TestMesherRotatesUvs(t *testing.T) {
+	log, axis := newLogType()
+	bank := NewBlockBank()
+	bank.AddType(log)
+	chunk := NewChunk(0, 0, 0)
+	chunk.Set(0, 0, 0, axis.Set(Block(0).ChangeType(log).Activate(true), AxisX))
+
+	data := (&CulledMesher{}).Generate(chunk, bank)
+	tr := log.faceTexture(chunk.Get(0, 0, 0), FaceTop).transform
+	for i := 0; i < len(data.Normals); i += 12 {
+		if data.Normals[i+1] != 1 {
+			continue
+		}
+
+		// the second vertex of the quad is at tile (1, 0)
+		vertex := i/3 + 1
+		uv := data.Uvs[vertex*2 : vertex*2+2]
+		if uv[0] != float32(tr[0]) || uv[1] != float32(tr[2]) {
+			t.Error(uv)
+		}
+	}
+
+	// differently oriented logs are not merged
+	chunk.Set(1, 0, 0, Block(0).ChangeType(log).Activate(true))
+	greedy := (&GreedyMesher{}).Generate(chunk, bank)
+	tops := 0
+	for i := 0; i < len(greedy.Normals); i += 12 {
+		if greedy.Normals[i+1] == 1 {
+			tops++
+		}
+	}
+	if tops != 2 {
+		t.Error(tops)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	log, axis := newLogType()
+	furnace, facing := newFurnaceType()
+	north := &glm.Vector3{X: 0, Y: -0.5, Z: -1}
+
+	if axis.Get(log.Orient(Block(0).ChangeType(log), FaceRight, north)) != AxisX {
+		t.Error()
+	}
+	if axis.Get(log.Orient(Block(0).ChangeType(log), FaceTop, north)) != AxisY {
+		t.Error()
+	}
+
+	// facing the player
+	if facing.Get(furnace.Orient(Block(0).ChangeType(furnace), FaceFront, north)) != FacingSouth {
+		t.Error()
+	}
+	if facing.Get(furnace.Orient(Block(0).ChangeType(furnace), FaceTop, north)) != FacingSouth {
+		t.Error()
+	}
+	if facing.Get(furnace.Orient(Block(0).ChangeType(furnace), FaceTop, &glm.Vector3{X: 1, Y: -1, Z: 0.5})) != FacingWest {
+		t.Error()
+	}
+
+	// no orientation properties
+	stone := newTestBank().Types[0]
+	if stone.Orient(Block(0).ChangeType(stone), FaceLeft, north) != Block(0).ChangeType(stone) {
+		t.Error()
+	}
+}
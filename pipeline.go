@@ -0,0 +1,189 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// names of the stock stages
+const (
+	StageTerrain     = "terrain"
+	StageSurface     = "surface"
+	StageCaves       = "caves"
+	StageOres        = "ores"
+	StageDecorations = "decorations"
+)
+
+// GenContext is shared by all stages, that generate a chunk. The column data is indexed by
+// x + z*ChunkWidth and filled by the terrain stage.
+type GenContext struct {
+	Position ChunkPosition
+	Bank     *BlockBank
+	// Rand is seeded per chunk & stage, so stages don't change the numbers of other stages
+	Rand *rand.Rand
+
+	// Heights are the world y of the first air block above the terrain
+	Heights [ChunkXZ]int
+	// Biomes are nil, if no terrain stage ran
+	Biomes [ChunkXZ]*Biome
+}
+
+func NewGenContext(pos ChunkPosition, bank *BlockBank) *GenContext {
+	return &GenContext{Position: pos, Bank: bank}
+}
+
+// StageFunc modifies the chunk. It is called concurrently for different chunks & must only
+// depend on the chunk, the context & the world coordinates.
+type StageFunc func(chunk *Chunk, ctx *GenContext)
+
+// Stage is a named step of a PipelineGenerator.
+type Stage struct {
+	Name string
+	Run  StageFunc
+}
+
+// PipelineGenerator generates chunks by running its stages in order.
+type PipelineGenerator struct {
+	seed   int64
+	stages []Stage
+}
+
+func NewPipelineGenerator(seed int64, stages ...Stage) *PipelineGenerator {
+	return &PipelineGenerator{seed: seed, stages: stages}
+}
+
+// Stages returns the stages in the order they run.
+func (g *PipelineGenerator) Stages() []Stage {
+	return g.stages
+}
+
+// Add appends a stage to the end of the pipeline.
+func (g *PipelineGenerator) Add(stage Stage) {
+	g.stages = append(g.stages, stage)
+}
+
+// InsertBefore inserts the stage in front of the stage with the given name. Returns false if
+// there is no such stage.
+func (g *PipelineGenerator) InsertBefore(name string, stage Stage) bool {
+	for i, s := range g.stages {
+		if s.Name == name {
+			g.stages = append(g.stages[:i], append([]Stage{stage}, g.stages[i:]...)...)
+			return true
+		}
+	}
+	return false
+}
+
+// Replace replaces the stage with the same name. Returns false if there is no such stage.
+func (g *PipelineGenerator) Replace(stage Stage) bool {
+	for i, s := range g.stages {
+		if s.Name == stage.Name {
+			g.stages[i] = stage
+			return true
+		}
+	}
+	return false
+}
+
+// Remove removes the stage with the given name. Returns false if there is no such stage.
+func (g *PipelineGenerator) Remove(name string) bool {
+	for i, s := range g.stages {
+		if s.Name == name {
+			g.stages = append(g.stages[:i], g.stages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (g *PipelineGenerator) GenerateChunkAt(x, y, z int, bank *BlockBank) *Chunk {
+	c := NewChunk(x, y, z)
+	ctx := NewGenContext(c.Position, bank)
+	for _, stage := range g.stages {
+		h := fnv.New64a()
+		h.Write([]byte(stage.Name))
+		ctx.Rand = NewChunkRand(g.seed^int64(h.Sum64()), x, y, z)
+		stage.Run(c, ctx)
+	}
+	return c
+}
+
+// ----------------------------------------------------------------------------
+
+// TerrainStage fills all columns up to the terrain height with the filler block of their biome.
+func TerrainStage(terrain *Terrain) Stage {
+	return Stage{StageTerrain, func(c *Chunk, ctx *GenContext) {
+		baseY := c.Position.Y * ChunkHeight
+		for z := 0; z < ChunkDepth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				col := terrain.columnAt(c.Position.X*ChunkWidth+x, c.Position.Z*ChunkDepth+z)
+				ctx.Heights[x+z*ChunkWidth] = col.height
+				ctx.Biomes[x+z*ChunkWidth] = col.biome
+
+				filler := Block(col.biome.Filler).Activate(true)
+				for y := 0; y < ChunkHeight && baseY+y < col.height; y++ {
+					c.Set(x, y, z, filler)
+				}
+			}
+		}
+	}}
+}
+
+// SurfaceStage replaces the top most terrain block of each column with the surface block of
+// its biome.
+func SurfaceStage() Stage {
+	return Stage{StageSurface, func(c *Chunk, ctx *GenContext) {
+		baseY := c.Position.Y * ChunkHeight
+		for z := 0; z < ChunkDepth; z++ {
+			for x := 0; x < ChunkWidth; x++ {
+				biome := ctx.Biomes[x+z*ChunkWidth]
+				y := ctx.Heights[x+z*ChunkWidth] - 1 - baseY
+				if biome == nil || y < 0 || y >= ChunkHeight {
+					continue
+				}
+				c.Set(x, y, z, Block(biome.Surface).Activate(true))
+			}
+		}
+	}}
+}
+
+// CaveStage carves caves with the given carver.
+func CaveStage(carver *CaveCarver) Stage {
+	return Stage{StageCaves, func(c *Chunk, ctx *GenContext) {
+		carver.Carve(c)
+	}}
+}
+
+// OreStage places the veins of the ores into the blocks they replace.
+func OreStage(ores ...*Ore) Stage {
+	return Stage{StageOres, func(c *Chunk, ctx *GenContext) {
+		for _, ore := range ores {
+			// every ore gets its own generator, so appending ores doesn't move the others
+			ore.Place(c, rand.New(rand.NewSource(ctx.Rand.Int63())))
+		}
+	}}
+}
+
+// DecorationStage places the features of the decorator at this point of the pipeline. The
+// blocks in the chunk itself are written right away, so the following stages see them. The
+// same decorator has to be set on the World, which distributes the blocks written into
+// neighbor chunks.
+func DecorationStage(decorator *Decorator) Stage {
+	return Stage{StageDecorations, func(c *Chunk, ctx *GenContext) {
+		// never nil, so the World does not place the features a second time
+		c.features = decorator.decorate(c)
+	}}
+}
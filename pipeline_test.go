@@ -0,0 +1,179 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import "testing"
+
+func recordStage(name string, log *[]string) Stage {
+	return Stage{name, func(c *Chunk, ctx *GenContext) {
+		*log = append(*log, name)
+	}}
+}
+
+func TestPipelineStages(t *testing.T) {
+	log := make([]string, 0)
+	gen := NewPipelineGenerator(1, recordStage("a", &log), recordStage("c", &log))
+	gen.Add(recordStage("d", &log))
+	if !gen.InsertBefore("c", recordStage("b", &log)) || gen.InsertBefore("x", recordStage("y", &log)) {
+		t.Error()
+	}
+	if !gen.Remove("d") || gen.Remove("d") {
+		t.Error()
+	}
+	gen.GenerateChunkAt(0, 0, 0, newTestBank())
+	if len(log) != 3 || log[0] != "a" || log[1] != "b" || log[2] != "c" {
+		t.Error(log)
+	}
+
+	log = log[:0]
+	if !gen.Replace(recordStage("b", &log)) || len(gen.Stages()) != 3 {
+		t.Error()
+	}
+}
+
+func TestPipelineStageRand(t *testing.T) {
+	// adding a stage does not change the random numbers of the others
+	var first, second int64
+	stage := Stage{"rand", func(c *Chunk, ctx *GenContext) {
+		second = ctx.Rand.Int63()
+	}}
+	gen := NewPipelineGenerator(1, stage)
+	gen.GenerateChunkAt(1, 2, 3, newTestBank())
+	first = second
+
+	gen.InsertBefore("rand", Stage{"other", func(c *Chunk, ctx *GenContext) {
+		ctx.Rand.Int63()
+	}})
+	gen.GenerateChunkAt(1, 2, 3, newTestBank())
+	if first != second {
+		t.Error()
+	}
+}
+
+func TestTerrainStage(t *testing.T) {
+	terrain := NewTerrain(16726)
+	for _, b := range newTestBiomes() {
+		terrain.Biomes.Register(b)
+	}
+
+	c := NewChunk(2, 0, -3)
+	ctx := NewGenContext(c.Position, newTestBank())
+	TerrainStage(terrain).Run(c, ctx)
+	for z := 0; z < ChunkDepth; z++ {
+		for x := 0; x < ChunkWidth; x++ {
+			height := terrain.HeightAt(2*ChunkWidth+x, -3*ChunkDepth+z)
+			biome := terrain.BiomeAt(2*ChunkWidth+x, -3*ChunkDepth+z)
+			if ctx.Heights[x+z*ChunkWidth] != height || ctx.Biomes[x+z*ChunkWidth] != biome {
+				t.Fatal("wrong column data")
+			}
+			for y := 0; y < ChunkHeight; y++ {
+				block := c.Get(x, y, z)
+				if block.Active() != (y < height) || (block.Active() && block.TypeID() != biome.Filler) {
+					t.Fatalf("wrong block at %v,%v,%v", x, y, z)
+				}
+			}
+		}
+	}
+}
+
+func TestSurfaceStage(t *testing.T) {
+	biome := &Biome{Surface: 2, Filler: 1}
+	c := NewChunk(0, 1, 0)
+	ctx := NewGenContext(c.Position, newTestBank())
+	for i := range ctx.Heights {
+		ctx.Biomes[i] = biome
+		ctx.Heights[i] = ChunkHeight + i%(ChunkHeight+2)
+	}
+	SurfaceStage().Run(c, ctx)
+
+	for z := 0; z < ChunkDepth; z++ {
+		for x := 0; x < ChunkWidth; x++ {
+			top := ctx.Heights[x+z*ChunkWidth] - 1 - ChunkHeight
+			for y := 0; y < ChunkHeight; y++ {
+				if c.Get(x, y, z).Active() != (y == top) {
+					t.Fatalf("wrong block at %v,%v,%v", x, y, z)
+				}
+			}
+		}
+	}
+}
+
+func TestOreStage(t *testing.T) {
+	c := solidChunk(0, 0, 0)
+	c.Set(0, 0, 0, Block(2).Activate(true))
+	ctx := NewGenContext(c.Position, newTestBank())
+	ctx.Rand = NewChunkRand(1, 0, 0, 0)
+	OreStage(&Ore{Block: 3, Replace: 1, Count: 200, MinY: 0, MaxY: 8}).Run(c, ctx)
+
+	ores := 0
+	for i := 0; i < ChunkXYZ; i++ {
+		if c.blocks.Get(i).TypeID() == 3 {
+			ores++
+			if i/ChunkXZ >= 8 {
+				t.Error("ore above MaxY")
+			}
+		}
+	}
+	if ores == 0 || c.Get(0, 0, 0).TypeID() != 2 {
+		t.Error(ores)
+	}
+}
+
+func TestDecorationStage(t *testing.T) {
+	decorator := NewDecorator(1, &TreeFeature{Ground: 1, Trunk: 2, Leaves: 3, Count: 4, MinHeight: 2, MaxHeight: 2, Radius: 1})
+	gen := NewPipelineGenerator(1, Stage{"ground", func(c *Chunk, ctx *GenContext) {
+		for i := 0; i < ChunkXZ; i++ {
+			c.blocks.Set(i, Block(1).Activate(true))
+		}
+	}}, DecorationStage(decorator), Stage{"check", func(c *Chunk, ctx *GenContext) {
+		// the following stages already see the trees
+		trees := 0
+		for i := ChunkXZ; i < ChunkXYZ; i++ {
+			if c.blocks.Get(i).Active() {
+				trees++
+			}
+		}
+		if trees == 0 {
+			t.Error("no trees in the chunk")
+		}
+	}})
+
+	c := gen.GenerateChunkAt(0, 0, 0, newTestBank())
+	if c.features == nil {
+		t.Error("features are placed again by the world")
+	}
+	if _, ok := c.features[c.Position]; ok {
+		t.Error("writes into the chunk itself are still pending")
+	}
+}
+
+func TestSimplexPipeline(t *testing.T) {
+	// the simplex generator is the terrain, surface & cave stages
+	simplex := newBiomeGenerator()
+	simplex.Caves = NewCaveCarver(16726, CaveWorm)
+	pipeline := NewPipelineGenerator(16726, TerrainStage(simplex.Terrain), SurfaceStage(), CaveStage(simplex.Caves))
+	for _, pos := range testPositions(1) {
+		a := simplex.GenerateChunkAt(pos.X, pos.Y, pos.Z, nil)
+		b := pipeline.GenerateChunkAt(pos.X, pos.Y, pos.Z, nil)
+		if chunkHash(a) != chunkHash(b) {
+			t.Errorf("chunk %v differs", pos.String())
+		}
+	}
+
+	checkDeterministic(t, func() Generator {
+		gen := NewPipelineGenerator(16726, TerrainStage(simplex.Terrain), SurfaceStage(), CaveStage(simplex.Caves),
+			OreStage(&Ore{Block: 3, Replace: 1, Count: 20, MinY: -100, MaxY: 100}))
+		return gen
+	})
+}
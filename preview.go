@@ -0,0 +1,181 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"hash/fnv"
+	"image"
+	"image/color"
+)
+
+type MapMode int
+
+const (
+	// MapSurface colors the pixels by the type of the top most block
+	MapSurface MapMode = iota
+	// MapHeight colors the pixels by the height of the top most block
+	MapHeight
+)
+
+// BiomeSource returns the biome of world columns, e.g. a Terrain or a SimplexGenerator.
+type BiomeSource interface {
+	BiomeAt(x, z int) *Biome
+}
+
+// MapOptions describe the region of a top-down map. X & Z are the first chunk, Width & Depth
+// the number of chunks. MinY & MaxY are the chunk layers, that are generated (inclusive).
+type MapOptions struct {
+	X, Z         int
+	Width, Depth int
+	MinY, MaxY   int
+
+	Mode MapMode
+	// Colors of the block types for MapSurface. Missing types get a color derived from the id.
+	Colors map[uint16]color.RGBA
+	// Biomes are blended over the map, if not nil
+	Biomes BiomeSource
+	// Decorator places its features on the map, if not nil. It is the decorator of the
+	// DecorationStage of the generator, or the one that is set on the World.
+	Decorator *Decorator
+}
+
+// RenderMap generates the chunks of the region & renders the top most blocks into an image with
+// one pixel per block column. The top of the image is at -z. It doesn't need OpenGL.
+func RenderMap(gen Generator, bank *BlockBank, opts *MapOptions) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width*ChunkWidth, opts.Depth*ChunkDepth))
+	minY := opts.MinY * ChunkHeight
+	maxY := (opts.MaxY + 1) * ChunkHeight
+	chunks := &mapChunks{gen: gen, bank: bank, decorator: opts.Decorator,
+		writes: make(map[ChunkPosition]map[ChunkPosition]featureWrites)}
+
+	for cz := 0; cz < opts.Depth; cz++ {
+		for cx := 0; cx < opts.Width; cx++ {
+			// top down, until every column hit a block
+			var tops [ChunkXZ]Block
+			var heights [ChunkXZ]int
+			found := 0
+			for cy := opts.MaxY; cy >= opts.MinY && found < ChunkXZ; cy-- {
+				chunk := chunks.generate(opts.X+cx, cy, opts.Z+cz)
+				for i := 0; i < ChunkXZ; i++ {
+					if tops[i].Active() {
+						continue
+					}
+					for y := ChunkHeight - 1; y >= 0; y-- {
+						if block := chunk.Get(i%ChunkWidth, y, i/ChunkWidth); block.Active() {
+							tops[i] = block
+							heights[i] = cy*ChunkHeight + y
+							found++
+							break
+						}
+					}
+				}
+			}
+
+			for i := 0; i < ChunkXZ; i++ {
+				x, z := i%ChunkWidth, i/ChunkWidth
+				px, pz := cx*ChunkWidth+x, cz*ChunkDepth+z
+				if !tops[i].Active() {
+					img.SetRGBA(px, pz, color.RGBA{0, 0, 0, 255})
+					continue
+				}
+
+				var c color.RGBA
+				if opts.Mode == MapHeight {
+					gray := uint8((heights[i] - minY) * 255 / (maxY - 1 - minY))
+					c = color.RGBA{gray, gray, gray, 255}
+				} else {
+					c = blockColor(opts.Colors, tops[i].TypeID())
+				}
+				if opts.Biomes != nil {
+					wx := (opts.X+cx)*ChunkWidth + x
+					wz := (opts.Z+cz)*ChunkDepth + z
+					if biome := opts.Biomes.BiomeAt(wx, wz); biome != nil {
+						h := fnv.New64a()
+						h.Write([]byte(biome.Name))
+						c = blendColor(c, hashColor(h.Sum64()))
+					}
+				}
+				img.SetRGBA(px, pz, c)
+			}
+		}
+	}
+
+	return img
+}
+
+// mapChunks generates the chunks of a map & places the features of the decorator, like the
+// World does. The writes of every chunk into its neighbors are kept, so each neighbor is only
+// generated once more.
+type mapChunks struct {
+	gen       Generator
+	bank      *BlockBank
+	decorator *Decorator
+	writes    map[ChunkPosition]map[ChunkPosition]featureWrites
+}
+
+func (m *mapChunks) generate(x, y, z int) *Chunk {
+	chunk := m.gen.GenerateChunkAt(x, y, z, m.bank)
+	if m.decorator == nil {
+		return chunk
+	}
+
+	pos := chunk.Position
+	m.writes[pos] = m.place(chunk)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			for dz := -1; dz <= 1; dz++ {
+				neighbor := ChunkPosition{pos.X + dx, pos.Y + dy, pos.Z + dz}
+				if neighbor == pos {
+					continue
+				}
+				writes, ok := m.writes[neighbor]
+				if !ok {
+					writes = m.place(m.gen.GenerateChunkAt(neighbor.X, neighbor.Y, neighbor.Z, m.bank))
+					m.writes[neighbor] = writes
+				}
+				if blocks, ok := writes[pos]; ok {
+					applyFeatureWrites(chunk, blocks)
+				}
+			}
+		}
+	}
+	return chunk
+}
+
+// place writes the features of the chunk into the chunk itself, unless a DecorationStage did
+// already. Returns the writes into the neighbors.
+func (m *mapChunks) place(chunk *Chunk) map[ChunkPosition]featureWrites {
+	writes := chunk.features
+	chunk.features = nil
+	if writes == nil {
+		writes = m.decorator.decorate(chunk)
+	}
+	return writes
+}
+
+func blockColor(colors map[uint16]color.RGBA, id uint16) color.RGBA {
+	if c, ok := colors[id]; ok {
+		return c
+	}
+	return hashColor(HashCoords(0, int(id), 0, 0))
+}
+
+// hashColor turns a hash into a bright color
+func hashColor(h uint64) color.RGBA {
+	return color.RGBA{uint8(64 + h%192), uint8(64 + (h>>8)%192), uint8(64 + (h>>16)%192), 255}
+}
+
+func blendColor(a, b color.RGBA) color.RGBA {
+	return color.RGBA{uint8((int(a.R) + int(b.R)) / 2), uint8((int(a.G) + int(b.G)) / 2), uint8((int(a.B) + int(b.B)) / 2), 255}
+}
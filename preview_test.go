@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestRenderMap(t *testing.T) {
+	gen := &hillGenerator{}
+	opts := &MapOptions{X: -1, Z: 2, Width: 2, Depth: 1, MinY: -1, MaxY: 1,
+		Colors: map[uint16]color.RGBA{1: {10, 20, 30, 255}}}
+	img := RenderMap(gen, nil, opts)
+	if img.Bounds().Dx() != 2*ChunkWidth || img.Bounds().Dy() != ChunkDepth {
+		t.Fatal(img.Bounds())
+	}
+	if img.RGBAAt(5, 7) != (color.RGBA{10, 20, 30, 255}) {
+		t.Error(img.RGBAAt(5, 7))
+	}
+
+	// the heights of the generator are 4..8, the range is -16..31
+	opts.Mode = MapHeight
+	img = RenderMap(gen, nil, opts)
+	for z := 0; z < ChunkDepth; z++ {
+		for x := 0; x < 2*ChunkWidth; x++ {
+			wx, wz := -ChunkWidth+x, 2*ChunkDepth+z
+			top := 3 + int(HashCoords(0, wx, 0, wz)%5)
+			gray := uint8((top + 16) * 255 / 47)
+			if img.RGBAAt(x, z) != (color.RGBA{gray, gray, gray, 255}) {
+				t.Fatalf("pixel %v,%v is %v, want %v", x, z, img.RGBAAt(x, z), gray)
+			}
+		}
+	}
+}
+
+func TestRenderMapBiomes(t *testing.T) {
+	gen := newBiomeGenerator()
+	opts := &MapOptions{X: -4, Z: -4, Width: 8, Depth: 8, MinY: 0, MaxY: 2}
+	plain := RenderMap(gen, nil, opts)
+	opts.Biomes = gen
+	overlay := RenderMap(gen, nil, opts)
+	if string(plain.Pix) == string(overlay.Pix) {
+		t.Error("biomes are not visible")
+	}
+
+	// maps are stable, so they can be compared to golden images
+	if string(RenderMap(gen, nil, opts).Pix) != string(overlay.Pix) {
+		t.Error("map changed")
+	}
+}
+
+func TestRenderMapDecorator(t *testing.T) {
+	ground := Stage{"ground", func(c *Chunk, ctx *GenContext) {
+		if c.Position.Y == 0 {
+			for i := 0; i < ChunkXZ; i++ {
+				c.blocks.Set(i, Block(1).Activate(true))
+			}
+		}
+	}}
+	decorator := NewDecorator(3, &TreeFeature{Ground: 1, Trunk: 2, Leaves: 3, Count: 6, MinHeight: 3, MaxHeight: 5, Radius: 3})
+	opts := &MapOptions{X: -2, Z: -2, Width: 4, Depth: 4, MinY: 0, MaxY: 1}
+
+	staged := NewPipelineGenerator(1, ground, DecorationStage(decorator))
+	crowns := RenderMap(staged, nil, opts)
+	opts.Decorator = decorator
+	full := RenderMap(staged, nil, opts)
+	if string(crowns.Pix) == string(full.Pix) {
+		t.Error("the crowns are cut off at the chunk borders")
+	}
+
+	// the same as placing the features without a DecorationStage
+	plain := NewPipelineGenerator(1, ground)
+	if string(RenderMap(plain, nil, opts).Pix) != string(full.Pix) {
+		t.Error("features differ")
+	}
+}
+
+func TestGeneratorRegistry(t *testing.T) {
+	RegisterGenerator("test", func(seed int64) Generator { return newTestHeightmapGenerator() })
+	gen, err := NewGeneratorByName("test", 1)
+	if _, ok := gen.(*HeightmapGenerator); !ok || err != nil {
+		t.Error(err)
+	}
+	if _, err := NewGeneratorByName("none", 1); err == nil {
+		t.Error()
+	}
+	names := GeneratorNames()
+	if len(names) < 3 || names[0] != "flat" {
+		t.Error(names)
+	}
+	delete(generators, "test")
+}
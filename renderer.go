@@ -11,25 +11,57 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !headless
+// +build !headless
+
 package vox
 
-import "github.com/go-gl/gl/v3.3-core/gl"
+import (
+	"sort"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/mbrlabs/vox/glm"
+)
+
+// alphaCutoff is the alpha below which the pixels of cutout blocks are discarded
+const alphaCutoff = 0.5
 
 const worldVert = `
 #version 330 
 
+const float AO_MIN = 0.45;
+const float LIGHT_FALLOFF = 0.8;
+const float MAX_LIGHT = 15.0;
+
 uniform mat4 u_mvp;
 uniform vec3 u_sun_direction;
 
 in vec3 a_pos;
 in vec3 a_norm;
 in vec2 a_uv;
+in vec4 a_region;
+in float a_ao;
+in vec2 a_light;
 
 out vec2 texCoords;
+flat out vec4 region;
 out float diffuse;
+out float occlusion;
+out float blockLight;
+out float skyLight;
+
+// lightLevel converts a light level to brightness, every level is a bit darker than the previous one
+float lightLevel(float level) {
+	return level > 0.0 ? pow(LIGHT_FALLOFF, MAX_LIGHT * (1.0 - level)) : 0.0;
+}
 
 void main() {
 	texCoords = a_uv;
+	region = a_region;
+	occlusion = mix(AO_MIN, 1.0, a_ao);
+
+	blockLight = lightLevel(a_light.x);
+	skyLight = lightLevel(a_light.y);
 	diffuse = dot(a_norm, u_sun_direction);
 	diffuse = clamp(diffuse, 0.2, 1);
     gl_Position = u_mvp * vec4(a_pos, 1.0);
@@ -41,15 +73,36 @@ const worldFrag = `
 
 uniform sampler2D tex;
 uniform vec3 u_sun_color;
+uniform float u_sun_intensity;
+uniform float u_alpha_cutoff;
+
+const vec3 BLOCK_LIGHT_COLOR = vec3(1.0, 0.9, 0.75);
 
 in vec2 texCoords;
+flat in vec4 region;
 in float diffuse;
+in float occlusion;
+in float blockLight;
+in float skyLight;
 
 out vec4 outColor;
 
 void main() {
-	vec4 light = vec4(diffuse * u_sun_color, 1);
-	outColor = light * texture(tex, texCoords);
+	// texCoords are in tile space, so wrap them into the atlas region to repeat the texture.
+	// The gradients are passed explicitly, because fract() breaks mipmap selection at tile borders.
+	vec2 uv = region.xy + fract(texCoords) * region.zw;
+	vec2 dx = dFdx(texCoords) * region.zw;
+	vec2 dy = dFdy(texCoords) * region.zw;
+
+	vec4 color = textureGrad(tex, uv, dx, dy);
+	if (color.a < u_alpha_cutoff) {
+		discard;
+	}
+
+	// the sun only reaches blocks under the open sky, torches light up the night
+	vec3 sun = diffuse * skyLight * u_sun_intensity * u_sun_color;
+	vec4 light = vec4(max(sun, blockLight * BLOCK_LIGHT_COLOR) * occlusion, 1);
+	outColor = light * color;
 }
 `
 
@@ -85,6 +138,8 @@ type WorldRenderer struct {
 	uniformSolidMvp     int32
 	uniformSunDirection int32
 	uniformSunColor     int32
+	uniformSunIntensity int32
+	uniformAlphaCutoff  int32
 
 	wireShader     *Shader
 	uniformWireMvp int32
@@ -96,6 +151,9 @@ func NewWorldRenderer() *WorldRenderer {
 		{Position: AttribIndexPositions, Name: "a_pos"},
 		{Position: AttribIndexUvs, Name: "a_uv"},
 		{Position: AttribIndexNormals, Name: "a_norm"},
+		{Position: AttribIndexRegions, Name: "a_region"},
+		{Position: AttribIndexOcclusion, Name: "a_ao"},
+		{Position: AttribIndexLight, Name: "a_light"},
 	}
 	ss, err := NewShader(worldVert, worldFrag, attribs)
 	if err != nil {
@@ -118,6 +176,8 @@ func NewWorldRenderer() *WorldRenderer {
 		uniformSolidMvp:     gl.GetUniformLocation(ss.ID, gl.Str("u_mvp\x00")),
 		uniformSunDirection: gl.GetUniformLocation(ss.ID, gl.Str("u_sun_direction\x00")),
 		uniformSunColor:     gl.GetUniformLocation(ss.ID, gl.Str("u_sun_color\x00")),
+		uniformSunIntensity: gl.GetUniformLocation(ss.ID, gl.Str("u_sun_intensity\x00")),
+		uniformAlphaCutoff:  gl.GetUniformLocation(ss.ID, gl.Str("u_alpha_cutoff\x00")),
 	}
 }
 
@@ -126,32 +186,77 @@ func (r *WorldRenderer) Dispose() {
 	r.wireShader.Dispose()
 }
 
+// Render draws the world in three passes: opaque blocks, cutout blocks with the alpha test and
+// finally translucent blocks with blending. The translucent chunks are drawn back to front and
+// don't write depth, so they don't hide each other. Faces inside of a chunk are not sorted.
 func (r *WorldRenderer) Render(cam *Camera, world *World, env *Environment) {
+	sunDir := env.Sun.Direction
+	sunColor := env.Sun.Color
+
+	r.solidShader.Enable()
+	gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
+	gl.UniformMatrix4fv(r.uniformSolidMvp, 1, false, &cam.Combined.Data[0])
+	gl.Uniform3f(r.uniformSunColor, sunColor.R, sunColor.G, sunColor.B)
+	gl.Uniform3f(r.uniformSunDirection, sunDir.X, sunDir.Y, sunDir.Z)
+	gl.Uniform1f(r.uniformSunIntensity, env.Sun.Intensity)
+
+	// opaque & cutout render pass
+	gl.Uniform1f(r.uniformAlphaCutoff, 0)
+	r.renderLayer(world.Chunks, LayerOpaque)
+	gl.Uniform1f(r.uniformAlphaCutoff, alphaCutoff)
+	r.renderLayer(world.Chunks, LayerCutout)
+
+	// translucent render pass
+	translucent := make([]*Chunk, 0)
 	for _, chunk := range world.Chunks {
+		if chunk.Mesh != nil && chunk.Mesh.LayerIndexCounts[LayerTranslucent] > 0 {
+			translucent = append(translucent, chunk)
+		}
+	}
+	if len(translucent) == 0 {
+		return
+	}
+	sortBackToFront(translucent, cam.position)
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.DepthMask(false)
+	gl.Uniform1f(r.uniformAlphaCutoff, 0)
+	for _, chunk := range translucent {
+		chunk.Mesh.Bind()
+		chunk.Mesh.DrawLayer(LayerTranslucent)
+	}
+	gl.DepthMask(true)
+	gl.Disable(gl.BLEND)
+}
+
+func (r *WorldRenderer) renderLayer(chunks map[ChunkPosition]*Chunk, layer RenderLayer) {
+	for _, chunk := range chunks {
 		// can happen if chunk is completly sourrounded by other chunks and not a single triange would be drawn
 		if chunk.Mesh == nil {
 			continue
 		}
-
-		sunDir := env.Sun.Direction
-		sunColor := env.Sun.Color
-
 		chunk.Mesh.Bind()
-
-		// solid render pass
-		r.solidShader.Enable()
-		gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
-		gl.UniformMatrix4fv(r.uniformSolidMvp, 1, false, &cam.Combined.Data[0])
-		gl.UniformMatrix4fv(r.uniformSolidMvp, 1, false, &cam.Combined.Data[0])
-		gl.Uniform3f(r.uniformSunColor, sunColor.R, sunColor.G, sunColor.B)
-		gl.Uniform3f(r.uniformSunDirection, sunDir.X, sunDir.Y, sunDir.Z)
-
-		gl.DrawElements(gl.TRIANGLES, chunk.Mesh.IndexCount, gl.UNSIGNED_SHORT, gl.PtrOffset(0))
+		chunk.Mesh.DrawLayer(layer)
 
 		// wireframe render
 		// r.wireShader.Enable()
 		// gl.PolygonMode(gl.FRONT_AND_BACK, gl.LINE)
 		// gl.UniformMatrix4fv(r.uniformWireMvp, 1, false, &cam.Combined.Data[0])
-		// gl.DrawElements(gl.TRIANGLES, chunk.Mesh.IndexCount, gl.UNSIGNED_SHORT, gl.PtrOffset(0))
+		// gl.DrawElements(gl.TRIANGLES, chunk.Mesh.IndexCount, gl.UNSIGNED_INT, gl.PtrOffset(0))
+	}
+}
+
+// sortBackToFront sorts the chunks by the distance of their center to the eye, the farthest first.
+func sortBackToFront(chunks []*Chunk, eye *glm.Vector3) {
+	dist := make(map[*Chunk]float32, len(chunks))
+	for _, c := range chunks {
+		// the blocks of a chunk span z-1..z in world space, see the meshers
+		dx := (float32(c.Position.X)+0.5)*ChunkWidth - eye.X
+		dy := (float32(c.Position.Y)+0.5)*ChunkHeight - eye.Y
+		dz := (float32(c.Position.Z)+0.5)*ChunkDepth - CubeSize - eye.Z
+		dist[c] = dx*dx + dy*dy + dz*dz
 	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return dist[chunks[i]] > dist[chunks[j]]
+	})
 }
@@ -0,0 +1,35 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !headless
+// +build !headless
+
+package vox
+
+import (
+	"testing"
+
+	"github.com/mbrlabs/vox/glm"
+)
+
+func TestSortBackToFront(t *testing.T) {
+	chunks := []*Chunk{NewChunk(0, 0, 0), NewChunk(3, 0, 0), NewChunk(-1, 0, 0), NewChunk(0, 0, -2)}
+	sortBackToFront(chunks, &glm.Vector3{X: ChunkWidth / 2, Y: ChunkHeight / 2, Z: 0})
+
+	expected := []ChunkPosition{{3, 0, 0}, {0, 0, -2}, {-1, 0, 0}, {0, 0, 0}}
+	for i, c := range chunks {
+		if c.Position != expected[i] {
+			t.Error(i, c.Position)
+		}
+	}
+}
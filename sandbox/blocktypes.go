@@ -11,6 +11,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !headless
+// +build !headless
+
 package main
 
 import (
@@ -32,9 +35,9 @@ func createBlockTypes(atlas *vox.TextureAtlas) []*vox.BlockType {
 	grassSide, _ := atlas.Regions["grass_side"]
 
 	types = append(types,
-		&vox.BlockType{TypeBrick, brick, brick, brick},
-		&vox.BlockType{TypeBedrock, bedrock, bedrock, bedrock},
-		&vox.BlockType{TypeGrass, grassTop, grassTop, grassSide},
+		&vox.BlockType{ID: TypeBrick, Top: brick, Bottom: brick, Side: brick},
+		&vox.BlockType{ID: TypeBedrock, Top: bedrock, Bottom: bedrock, Side: bedrock},
+		&vox.BlockType{ID: TypeGrass, Top: grassTop, Bottom: grassTop, Side: grassSide},
 	)
 
 	return types
@@ -11,6 +11,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !headless
+// +build !headless
+
 package main
 
 import (
@@ -51,7 +54,20 @@ func (s *Sandbox) Create() {
 	s.cam.Update()
 
 	// build world
-	s.world = vox.NewWorld(s.blockBank, &vox.CulledMesher{}, vox.NewSimplexGenerator(16726))
+	config, err := vox.LoadGeneratorConfig("assets/worldgen.json")
+	if err != nil {
+		panic(err)
+	}
+	generator, decorator, err := config.NewGenerator(s.blockBank)
+	if err != nil {
+		panic(err)
+	}
+	provider := vox.NewChainProvider(
+		vox.NewCacheProvider(1024),
+		vox.NewGeneratorProvider(generator, s.blockBank),
+	)
+	s.world = vox.NewWorld(s.blockBank, &vox.GreedyMesher{SmoothLighting: true}, provider)
+	s.world.Decorator = decorator
 
 	// setup fps controller
 	s.fpsController = vox.NewFpsController(s.cam)
@@ -62,12 +78,16 @@ func (s *Sandbox) Create() {
 	s.renderer = vox.NewWorldRenderer()
 	s.fpsLogger = &vox.FpsLogger{}
 	s.worldController = vox.NewInifinteWorldController(s.cam, s.world)
+	s.worldController.VerticalRadius = 2
+	s.worldController.MinY = -1
+	s.worldController.MaxY = 2
 	s.env = vox.NewEnvironment()
 
 	gl.Enable(gl.DEPTH_TEST)
 }
 
 func (s *Sandbox) Dispose() {
+	s.world.Dispose()
 	s.renderer.Dispose()
 	s.atlas.Dispose()
 }
@@ -17,14 +17,10 @@ import (
 	"os"
 
 	"image"
+	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 
-	"io/ioutil"
-
-	"encoding/json"
-
-	"github.com/go-gl/gl/v3.3-core/gl"
 	"github.com/mbrlabs/vox/glm"
 )
 
@@ -34,25 +30,39 @@ type Pixmap struct {
 	Height int32
 }
 
+// NewPixmap loads the image at the given path & panics if that fails.
 func NewPixmap(path string) *Pixmap {
-	// decode image
-	file, err := os.Open(path)
+	pixmap, err := LoadPixmap(path)
 	if err != nil {
 		panic(err)
 	}
+	return pixmap
+}
+
+// LoadPixmap decodes the png or jpeg image at the given path.
+func LoadPixmap(path string) (*Pixmap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 	img, _, err := image.Decode(file)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return NewPixmapFromImage(img), nil
+}
 
-	// extract pixels
+// NewPixmapFromImage extracts the RGBA pixels of the image. The colors are not premultiplied
+// with the alpha. The rows are stored bottom up, the way OpenGL expects them.
+func NewPixmapFromImage(img image.Image) *Pixmap {
 	bounds := img.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
-	pixels := make([]uint8, 0)
-	for y := height - 1; y >= 0; y-- {
-		for x := 0; x < width; x++ {
-			r, g, b, _ := img.At(x, y).RGBA()
-			pixels = append(pixels, uint8(r/257), uint8(g/257), uint8(b/257))
+	width, height := bounds.Dx(), bounds.Dy()
+	pixels := make([]uint8, 0, width*height*4)
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			pixels = append(pixels, c.R, c.G, c.B, c.A)
 		}
 	}
 
@@ -63,6 +73,18 @@ func NewPixmap(path string) *Pixmap {
 	}
 }
 
+// RGB returns the color of the pixel at x, y. y is counted from the top of the image.
+func (p *Pixmap) RGB(x, y int) (r, g, b uint8) {
+	r, g, b, _ = p.RGBA(x, y)
+	return r, g, b
+}
+
+// RGBA returns the color & alpha of the pixel at x, y. y is counted from the top of the image.
+func (p *Pixmap) RGBA(x, y int) (r, g, b, a uint8) {
+	i := ((int(p.Height)-1-y)*int(p.Width) + x) * 4
+	return p.Data[i], p.Data[i+1], p.Data[i+2], p.Data[i+3]
+}
+
 type Texture struct {
 	Disposable
 	id     uint32
@@ -70,33 +92,6 @@ type Texture struct {
 	height int32
 }
 
-func NewTexture(path string, genMipmaps bool) *Texture {
-	pixmap := NewPixmap(path)
-
-	// generate texture
-	tex := &Texture{
-		width:  pixmap.Width,
-		height: pixmap.Height,
-	}
-	gl.GenTextures(1, &tex.id)
-
-	// upload to gpu & generate mipmaps
-	gl.BindTexture(gl.TEXTURE_2D, tex.id)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, tex.width, tex.height, 0, gl.RGB, gl.UNSIGNED_BYTE, gl.Ptr(pixmap.Data))
-	if genMipmaps {
-		gl.GenerateMipmap(gl.TEXTURE_2D)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
-		gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_LOD_BIAS, -1)
-	} else {
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
-	}
-	gl.BindTexture(gl.TEXTURE_2D, 0)
-
-	return tex
-}
-
 func (t *Texture) Width() int32 {
 	return t.width
 }
@@ -105,19 +100,6 @@ func (t *Texture) Height() int32 {
 	return t.height
 }
 
-func (t *Texture) Bind() {
-	gl.ActiveTexture(gl.TEXTURE0)
-	gl.BindTexture(gl.TEXTURE_2D, t.id)
-}
-
-func (t *Texture) Unbind() {
-	gl.BindTexture(gl.TEXTURE_2D, 0)
-}
-
-func (t *Texture) Dispose() {
-	gl.DeleteTextures(1, &t.id)
-}
-
 type TextureRegion struct {
 	Atlas *TextureAtlas
 	Uvs   [4]glm.Vector2
@@ -133,58 +115,3 @@ type TextureAtlas struct {
 	Regions map[string]*TextureRegion
 	texture *Texture
 }
-
-func NewTextureAtlas(jsonPath, imagePath string) *TextureAtlas {
-	// create texture
-	texture := NewTexture(imagePath, true)
-	atlas := &TextureAtlas{make(map[string]*TextureRegion), texture}
-	atlasWidth, atlasHeight := float32(texture.width), float32(texture.height)
-
-	// parse json
-	rawJSON, err := ioutil.ReadFile(jsonPath)
-	if err != nil {
-		panic(err)
-	}
-	regions := make([]*TextureRegion, 0)
-	err = json.Unmarshal(rawJSON, &regions)
-	if err != nil {
-		panic(err)
-	}
-
-	// calulcate uvs & put regions in map
-	for _, region := range regions {
-		region.Uvs[0] = glm.Vector2{
-			region.X / atlasWidth,
-			region.Y / atlasHeight,
-		}
-		region.Uvs[1] = glm.Vector2{
-			(region.X + region.Width) / atlasWidth,
-			region.Y / atlasHeight,
-		}
-		region.Uvs[2] = glm.Vector2{
-			(region.X + region.Width) / atlasWidth,
-			(region.Y + region.Height) / atlasHeight,
-		}
-		region.Uvs[3] = glm.Vector2{
-			region.X / atlasWidth,
-			(region.Y + region.Height) / atlasHeight,
-		}
-
-		region.Atlas = atlas
-		atlas.Regions[region.Name] = region
-	}
-
-	return atlas
-}
-
-func (a *TextureAtlas) Bind() {
-	a.texture.Bind()
-}
-
-func (a *TextureAtlas) Unbind() {
-	a.texture.Unbind()
-}
-
-func (a *TextureAtlas) Dispose() {
-	a.texture.Dispose()
-}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !headless
+// +build !headless
+
+package vox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/mbrlabs/vox/glm"
+)
+
+func NewTexture(path string, genMipmaps bool) *Texture {
+	pixmap := NewPixmap(path)
+
+	// generate texture
+	tex := &Texture{
+		width:  pixmap.Width,
+		height: pixmap.Height,
+	}
+	gl.GenTextures(1, &tex.id)
+
+	// upload to gpu & generate mipmaps
+	gl.BindTexture(gl.TEXTURE_2D, tex.id)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, tex.width, tex.height, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixmap.Data))
+	if genMipmaps {
+		gl.GenerateMipmap(gl.TEXTURE_2D)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+		gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_LOD_BIAS, -1)
+	} else {
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	return tex
+}
+
+func (t *Texture) Bind() {
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, t.id)
+}
+
+func (t *Texture) Unbind() {
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func (t *Texture) Dispose() {
+	gl.DeleteTextures(1, &t.id)
+}
+
+func NewTextureAtlas(jsonPath, imagePath string) *TextureAtlas {
+	// create texture
+	texture := NewTexture(imagePath, true)
+	atlas := &TextureAtlas{make(map[string]*TextureRegion), texture}
+	atlasWidth, atlasHeight := float32(texture.width), float32(texture.height)
+
+	// parse json
+	rawJSON, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		panic(err)
+	}
+	regions := make([]*TextureRegion, 0)
+	err = json.Unmarshal(rawJSON, &regions)
+	if err != nil {
+		panic(err)
+	}
+
+	// calulcate uvs & put regions in map
+	for _, region := range regions {
+		region.Uvs[0] = glm.Vector2{
+			region.X / atlasWidth,
+			region.Y / atlasHeight,
+		}
+		region.Uvs[1] = glm.Vector2{
+			(region.X + region.Width) / atlasWidth,
+			region.Y / atlasHeight,
+		}
+		region.Uvs[2] = glm.Vector2{
+			(region.X + region.Width) / atlasWidth,
+			(region.Y + region.Height) / atlasHeight,
+		}
+		region.Uvs[3] = glm.Vector2{
+			region.X / atlasWidth,
+			(region.Y + region.Height) / atlasHeight,
+		}
+
+		region.Atlas = atlas
+		atlas.Regions[region.Name] = region
+	}
+
+	return atlas
+}
+
+func (a *TextureAtlas) Bind() {
+	a.texture.Bind()
+}
+
+func (a *TextureAtlas) Unbind() {
+	a.texture.Unbind()
+}
+
+func (a *TextureAtlas) Dispose() {
+	a.texture.Dispose()
+}
@@ -26,3 +26,21 @@ func Sign(x int) int {
 
 	return 0
 }
+
+// FloorDiv divides a by b and rounds towards negative infinity. b must be positive.
+func FloorDiv(a, b int) int {
+	if a < 0 {
+		return (a - b + 1) / b
+	}
+	return a / b
+}
+
+func clampInt(x, min, max int) int {
+	if x < min {
+		return min
+	}
+	if x > max {
+		return max
+	}
+	return x
+}
@@ -15,119 +15,486 @@ package vox
 
 import (
 	"math"
-)
+	"runtime"
+	"sync"
+	"time"
 
-const Radius = 12
+	"github.com/mbrlabs/vox/glm"
+)
 
 type World struct {
-	mesher    Mesher
-	generator Generator
-	bank      *BlockBank
+	mesher   Mesher
+	provider ChunkProvider
+	bank     *BlockBank
 
 	// Chunks are all chunks that are ready to be rendered
 	Chunks map[ChunkPosition]*Chunk
 	// These are ALL chunks that are currently loaded (not included chunks that are scheduled for removal)
 	allChunks map[ChunkPosition]*Chunk
+	// These are chunks that need to be generated
+	generatingNeeded *chunkQueue
 	// These are chunks that need their mesh to be regenerated
-	meshingNeeded map[ChunkPosition]*Chunk
+	meshingNeeded *chunkQueue
 	// These are chunks that need thier mesh to be uploaded to OpenGL
-	uploadNeeded map[ChunkPosition]*Chunk
+	uploadNeeded *chunkQueue
 	// These are chunks that need to be disposed
 	disposeNeeded map[ChunkPosition]*Chunk
 
+	// These are chunks that are currently generated or meshed by a worker
+	generating map[ChunkPosition]bool
+	meshing    map[ChunkPosition]*Chunk
+
+	// chunkLock guards the blocks, light & neighbors of all loaded chunks. The workers read
+	// them while meshing, only the update goroutine modifies them.
+	chunkLock sync.RWMutex
+	light     *lightEngine
+
+	// the queues are ordered by the distance to the focus chunk
+	focus          ChunkPosition
+	focusDirection glm.Vector3
+
+	// worker pool
+	generateJobs chan ChunkPosition
+	meshJobs     chan *Chunk
+	generated    chan generateResult
+	meshed       chan meshResult
+	quit         chan struct{}
+
+	// Workers is the number of goroutines that generate & mesh chunks. It has to be set before
+	// the first update. If it is 0, everything is done synchronously in Update.
+	Workers            int
 	MaxUploadsPerFrame int
+	// MaxUploadTime is the time per frame after which no more meshes are uploaded. 0 means no limit.
+	MaxUploadTime time.Duration
+	// ViewBias prefers chunks in view direction of the focus. It ranges from 0 (no bias) to 1.
+	ViewBias float32
+	// Decorator places features on generated chunks, if not nil. It has to be set before the
+	// first update.
+	Decorator *Decorator
+}
+
+type generateResult struct {
+	pos    ChunkPosition
+	chunk  *Chunk
+	writes map[ChunkPosition]featureWrites
+	// the light of the chunk on its own, see chunkLight
+	light []uint8
+}
+
+type meshResult struct {
+	chunk *Chunk
+	data  *MeshData
 }
 
-// NewWorld creates a new world
-func NewWorld(bank *BlockBank, mesher Mesher, generator Generator) *World {
-	return &World{
-		mesher:    mesher,
-		generator: generator,
-		bank:      bank,
+// NewWorld creates a new world, that gets its chunks from the given provider.
+func NewWorld(bank *BlockBank, mesher Mesher, provider ChunkProvider) *World {
+	workers := runtime.NumCPU() - 1
+	if workers < 1 {
+		workers = 1
+	}
+
+	w := &World{
+		mesher:   mesher,
+		provider: provider,
+		bank:     bank,
 
 		Chunks:        make(map[ChunkPosition]*Chunk),
 		allChunks:     make(map[ChunkPosition]*Chunk),
-		meshingNeeded: make(map[ChunkPosition]*Chunk),
-		uploadNeeded:  make(map[ChunkPosition]*Chunk),
 		disposeNeeded: make(map[ChunkPosition]*Chunk),
+		generating:    make(map[ChunkPosition]bool),
+		meshing:       make(map[ChunkPosition]*Chunk),
+		light:         newLightEngine(bank),
 
+		Workers:            workers,
 		MaxUploadsPerFrame: 8,
 	}
+	w.generatingNeeded = newChunkQueue(w.priority)
+	w.meshingNeeded = newChunkQueue(w.priority)
+	w.uploadNeeded = newChunkQueue(w.priority)
+
+	return w
+}
+
+// SetFocus sets the chunk the player is in and the view direction. Chunks closer to the focus
+// are generated, meshed & uploaded first. The queues are only re-evaluated if the focus moves
+// to another chunk or the view direction changes significantly.
+func (w *World) SetFocus(pos ChunkPosition, direction *glm.Vector3) {
+	dir := *direction
+	dir.Norm()
+
+	turned := w.ViewBias > 0 && w.focusDirection.X*dir.X+w.focusDirection.Y*dir.Y+w.focusDirection.Z*dir.Z < 0.9
+	if pos == w.focus && !turned {
+		return
+	}
+
+	w.focus = pos
+	w.focusDirection = dir
+	w.generatingNeeded.reprioritize()
+	w.meshingNeeded.reprioritize()
+	w.uploadNeeded.reprioritize()
+}
+
+// priority returns the distance of the chunk to the focus, reduced by the view bias if the chunk
+// lies in view direction. Lower values have a higher priority.
+func (w *World) priority(pos ChunkPosition) float32 {
+	dist := pos.Distance(&w.focus)
+	if w.ViewBias == 0 || dist == 0 {
+		return dist
+	}
+
+	dx := float32(pos.X - w.focus.X)
+	dy := float32(pos.Y - w.focus.Y)
+	dz := float32(pos.Z - w.focus.Z)
+	cos := (dx*w.focusDirection.X + dy*w.focusDirection.Y + dz*w.focusDirection.Z) / dist
+	return dist * (1 - w.ViewBias*cos)
 }
 
-// GenerateNewChunk generates a new chunk at the given chunk-coordinates.
+// GenerateNewChunk schedules the generation of a new chunk at the given chunk-coordinates.
 // This does not perform, any OpenGL calls.
 func (w *World) GenerateNewChunk(x, y, z int) {
-	// generate chunk
-	chunk := w.generator.GenerateChunkAt(x, y, z, w.bank)
-	chunk.setNeighbors(w.allChunks)
-	// TODO: re-mesh neighbors
-
-	// add to world
-	w.allChunks[chunk.Position] = chunk
-	w.meshingNeeded[chunk.Position] = chunk
+	pos := ChunkPosition{x, y, z}
+	if w.allChunks[pos] != nil || w.generating[pos] {
+		return
+	}
+	w.generatingNeeded.put(pos, nil)
 }
 
 // RemoveChunk schedules the cunk for removal.
 func (w *World) RemoveChunk(x, y, z int) {
-	chunk := w.allChunks[ChunkPosition{x, y, z}]
+	pos := ChunkPosition{x, y, z}
+
+	// the result of a running generation is dropped & released, once it arrives
+	w.generatingNeeded.remove(pos)
+	delete(w.generating, pos)
+
+	chunk := w.allChunks[pos]
 	if chunk != nil {
-		// TODO: re-mesh neighbors
+		w.chunkLock.Lock()
 		chunk.unsetNeighbors()
+		w.chunkLock.Unlock()
+
 		delete(w.allChunks, chunk.Position)
 		delete(w.Chunks, chunk.Position)
-		delete(w.uploadNeeded, chunk.Position)
-		delete(w.meshingNeeded, chunk.Position)
+		if w.Decorator != nil {
+			w.Decorator.remove(chunk.Position)
+		}
+		w.uploadNeeded.remove(chunk.Position)
+		w.meshingNeeded.remove(chunk.Position)
+		chunk.meshData = nil
 
 		w.disposeNeeded[chunk.Position] = chunk
+		w.provider.ReleaseChunk(chunk)
+
+		// the border faces of the neighbors are visible now
+		w.scheduleNeighborMeshing(chunk)
 	}
 }
 
-// Update updates the chunk meshes
+// GetBlock returns the block at the given world coordinates. Blocks of chunks that
+// are not loaded are BlockNil.
+func (w *World) GetBlock(x, y, z int) Block {
+	chunk, lx, ly, lz := w.chunkAt(x, y, z)
+	if chunk == nil {
+		return BlockNil
+	}
+	return chunk.Get(lx, ly, lz)
+}
+
+// SetBlock sets the block at the given world coordinates and schedules the re-meshing of
+// all chunks affected by the change. This includes adjacent chunks if the block sits on
+// a chunk border. Returns false if the chunk of the block is not loaded.
+func (w *World) SetBlock(x, y, z int, block Block) bool {
+	chunk, lx, ly, lz := w.chunkAt(x, y, z)
+	if chunk == nil {
+		return false
+	}
+	if chunk.Get(lx, ly, lz) == block {
+		return true
+	}
+	w.chunkLock.Lock()
+	chunk.Set(lx, ly, lz, block)
+	w.light.update(chunk, lx, ly, lz)
+	w.chunkLock.Unlock()
+	chunk.modified = true
+	for _, pos := range w.light.flushChanged() {
+		w.scheduleMeshing(pos)
+	}
+
+	// a block on the border is part of the neighbor meshes as well (culling & occlusion)
+	minX, maxX := borderRange(lx, ChunkWidth)
+	minY, maxY := borderRange(ly, ChunkHeight)
+	minZ, maxZ := borderRange(lz, ChunkDepth)
+	pos := chunk.Position
+	for dx := minX; dx <= maxX; dx++ {
+		for dy := minY; dy <= maxY; dy++ {
+			for dz := minZ; dz <= maxZ; dz++ {
+				w.scheduleMeshing(ChunkPosition{pos.X + dx, pos.Y + dy, pos.Z + dz})
+			}
+		}
+	}
+
+	return true
+}
+
+// Update generates & meshes chunks and uploads the chunk meshes
 func (w *World) Update() {
 	w.processDispose()
+	w.processGenerating()
 	w.processMeshing()
 	w.processUploading()
 }
 
+// Dispose stops the workers, releases all chunks to the provider and disposes all chunk meshes.
+func (w *World) Dispose() {
+	if w.quit != nil {
+		close(w.quit)
+		w.quit = nil
+	}
+
+	for _, c := range w.allChunks {
+		w.provider.ReleaseChunk(c)
+		w.disposeNeeded[c.Position] = c
+	}
+	w.processDispose()
+}
+
+func (w *World) startWorkers() {
+	if w.quit != nil || w.Workers <= 0 {
+		return
+	}
+
+	w.generateJobs = make(chan ChunkPosition, w.Workers)
+	w.meshJobs = make(chan *Chunk, w.Workers)
+	w.generated = make(chan generateResult, 4*w.Workers)
+	w.meshed = make(chan meshResult, 4*w.Workers)
+	w.quit = make(chan struct{})
+	for i := 0; i < w.Workers; i++ {
+		go w.work(w.quit)
+	}
+}
+
+// work runs in its own goroutine & must not touch OpenGL or any of the world maps.
+func (w *World) work(quit chan struct{}) {
+	for {
+		select {
+		case pos := <-w.generateJobs:
+			select {
+			case w.generated <- w.generate(pos):
+			case <-quit:
+				return
+			}
+		case chunk := <-w.meshJobs:
+			w.chunkLock.RLock()
+			data := w.mesher.Generate(chunk, w.bank)
+			w.chunkLock.RUnlock()
+			select {
+			case w.meshed <- meshResult{chunk, data}:
+			case <-quit:
+				return
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (w *World) processGenerating() {
+	w.startWorkers()
+
+	// add finished chunks to the world
+	added := make([]generateResult, 0)
+	if w.quit != nil {
+	receive:
+		for {
+			select {
+			case result := <-w.generated:
+				if w.generating[result.pos] {
+					delete(w.generating, result.pos)
+					if result.chunk != nil {
+						added = append(added, result)
+					}
+				} else if result.chunk != nil {
+					// the chunk was removed while it was generated, the provider gets it back
+					w.provider.ReleaseChunk(result.chunk)
+				}
+			default:
+				break receive
+			}
+		}
+	}
+
+	// schedule new chunks
+schedule:
+	for w.generatingNeeded.len() > 0 {
+		pos, _ := w.generatingNeeded.pop()
+		if w.quit == nil {
+			if result := w.generate(pos); result.chunk != nil {
+				added = append(added, result)
+			}
+			continue
+		}
+
+		select {
+		case w.generateJobs <- pos:
+			w.generating[pos] = true
+		default:
+			w.generatingNeeded.put(pos, nil)
+			break schedule
+		}
+	}
+
+	if len(added) == 0 {
+		return
+	}
+
+	w.chunkLock.Lock()
+	for _, result := range added {
+		result.chunk.setNeighbors(w.allChunks)
+		w.allChunks[result.pos] = result.chunk
+		// a cached chunk still has the light of its last stay in the world
+		result.chunk.light = nil
+	}
+
+	// the workers lit the chunks on their own, only the light across the borders is left
+	for _, result := range added {
+		w.light.mergeChunk(result.chunk, result.light)
+	}
+
+	// features, that cross the chunk borders, change blocks of the loaded chunks
+	decorated := make([]*Chunk, 0)
+	if w.Decorator != nil {
+		for _, result := range added {
+			result.chunk.needsDecoration = false
+			for chunk, indices := range w.Decorator.add(result.chunk, result.writes, w.allChunks) {
+				w.light.updateBlocks(chunk, indices)
+				if chunk != result.chunk {
+					decorated = append(decorated, chunk)
+				}
+			}
+		}
+	}
+	w.chunkLock.Unlock()
+	for _, pos := range w.light.flushChanged() {
+		w.scheduleMeshing(pos)
+	}
+
+	for _, result := range added {
+		w.meshingNeeded.put(result.pos, result.chunk)
+		// the border faces & occlusion of the neighbors might have changed
+		w.scheduleNeighborMeshing(result.chunk)
+	}
+	for _, chunk := range decorated {
+		w.scheduleMeshing(chunk.Position)
+		w.scheduleNeighborMeshing(chunk)
+	}
+}
+
+// generate gets the chunk from the provider, places the features of generated chunks & lights
+// the chunk on its own. It is called by the workers.
+func (w *World) generate(pos ChunkPosition) generateResult {
+	chunk := w.provider.GetChunk(pos.X, pos.Y, pos.Z)
+	result := generateResult{pos: pos, chunk: chunk}
+	if chunk == nil {
+		return result
+	}
+	if chunk.needsDecoration && w.Decorator != nil {
+		// a DecorationStage might have placed the features already
+		result.writes = chunk.features
+		if result.writes == nil {
+			result.writes = w.Decorator.decorate(chunk)
+		}
+	}
+	chunk.features = nil
+	result.light = chunkLight(w.bank, chunk)
+	return result
+}
+
 func (w *World) processMeshing() {
-	if len(w.meshingNeeded) > 0 {
-		for _, c := range w.meshingNeeded {
-			c.meshData = w.mesher.Generate(c, w.bank)
-			if c.meshData != nil {
-				w.uploadNeeded[c.Position] = c
+	w.startWorkers()
+
+	// collect finished meshes
+	if w.quit != nil {
+	receive:
+		for {
+			select {
+			case result := <-w.meshed:
+				delete(w.meshing, result.chunk.Position)
+				w.finishMeshing(result.chunk, result.data)
+			default:
+				break receive
 			}
 		}
+	}
+
+	// chunks that are meshed right now have to wait for the running job,
+	// otherwise an outdated mesh might arrive last
+	waiting := make([]*Chunk, 0)
+	defer func() {
+		for _, c := range waiting {
+			w.meshingNeeded.put(c.Position, c)
+		}
+	}()
+
+	for w.meshingNeeded.len() > 0 {
+		pos, c := w.meshingNeeded.pop()
+		if w.quit == nil {
+			w.finishMeshing(c, w.mesher.Generate(c, w.bank))
+			continue
+		}
 
-		w.meshingNeeded = make(map[ChunkPosition]*Chunk, 0)
+		if w.meshing[pos] != nil {
+			waiting = append(waiting, c)
+			continue
+		}
+
+		select {
+		case w.meshJobs <- c:
+			w.meshing[pos] = c
+		default:
+			waiting = append(waiting, c)
+			return
+		}
 	}
 }
 
-func (w *World) processUploading() {
-	if len(w.uploadNeeded) == 0 {
+// finishMeshing queues the new mesh data for uploading, if the chunk is still loaded.
+func (w *World) finishMeshing(chunk *Chunk, data *MeshData) {
+	if w.allChunks[chunk.Position] != chunk {
 		return
 	}
 
+	// chunks without mesh data still need an upload to remove their old mesh
+	if data != nil || chunk.Mesh != nil {
+		chunk.meshData = data
+		w.uploadNeeded.put(chunk.Position, chunk)
+	}
+}
+
+func (w *World) processUploading() {
+	start := time.Now()
 	count := w.MaxUploadsPerFrame
-	for _, chunk := range w.uploadNeeded {
-		delete(w.uploadNeeded, chunk.Position)
+	for w.uploadNeeded.len() > 0 {
+		_, chunk := w.uploadNeeded.pop()
 
 		// dispose old mesh
 		if chunk.Mesh != nil {
 			chunk.Mesh.Dispose()
+			chunk.Mesh = nil
 		}
 
 		// upload new mesh
-		chunk.Mesh = NewMesh()
-		chunk.Mesh.Load(chunk.meshData)
-		chunk.meshData = nil
+		if chunk.meshData != nil {
+			chunk.Mesh = NewMesh()
+			chunk.Mesh.Load(chunk.meshData)
+			chunk.meshData = nil
+		}
 
 		// add to list
 		w.Chunks[chunk.Position] = chunk
 
 		// done?
 		count--
-		if count == 0 {
+		if count == 0 || (w.MaxUploadTime > 0 && time.Since(start) >= w.MaxUploadTime) {
 			return
 		}
 	}
@@ -139,98 +506,161 @@ func (w *World) processDispose() {
 			delete(w.disposeNeeded, c.Position)
 			if c.Mesh != nil {
 				c.Mesh.Dispose()
+				c.Mesh = nil
 			}
 		}
 	}
 }
 
-func (w *World) processGenerating() {
-	// TODO
+// chunkAt returns the loaded chunk that contains the given world coordinates, along with the
+// coordinates inside of that chunk.
+func (w *World) chunkAt(x, y, z int) (chunk *Chunk, lx, ly, lz int) {
+	cx := FloorDiv(x, ChunkWidth)
+	cy := FloorDiv(y, ChunkHeight)
+	cz := FloorDiv(z, ChunkDepth)
+	chunk = w.allChunks[ChunkPosition{cx, cy, cz}]
+	return chunk, x - cx*ChunkWidth, y - cy*ChunkHeight, z - cz*ChunkDepth
+}
+
+// scheduleMeshing schedules the re-meshing of the chunk at the given position, if it is loaded.
+func (w *World) scheduleMeshing(pos ChunkPosition) {
+	if chunk, ok := w.allChunks[pos]; ok {
+		w.meshingNeeded.put(pos, chunk)
+	}
+}
+
+// scheduleNeighborMeshing schedules the re-meshing of all loaded chunks around the given chunk.
+func (w *World) scheduleNeighborMeshing(chunk *Chunk) {
+	pos := chunk.Position
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			for dz := -1; dz <= 1; dz++ {
+				if dx != 0 || dy != 0 || dz != 0 {
+					w.scheduleMeshing(ChunkPosition{pos.X + dx, pos.Y + dy, pos.Z + dz})
+				}
+			}
+		}
+	}
 }
 
+// borderRange returns the range of neighbor chunk offsets along one axis, that
+// are affected by a block at the given chunk coordinate.
+func borderRange(coord, size int) (int, int) {
+	if coord == 0 {
+		return -1, 0
+	} else if coord == size-1 {
+		return 0, 1
+	}
+	return 0, 0
+}
+
+// ----------------------------------------------------------------------------
+
+// LoadShape is the shape of the area, in which chunks are loaded around the camera.
+type LoadShape int
+
+const (
+	// LoadCylinder loads all chunks within the horizontal radius, VerticalRadius chunks above & below
+	LoadCylinder LoadShape = iota
+	// LoadSphere loads all chunks within an ellipsoid spanned by the horizontal & vertical radius
+	LoadSphere
+)
+
 type InfiniteWorldController struct {
+	// Radius is the horizontal distance in chunks, in which chunks are loaded
+	Radius int
+	// VerticalRadius is the number of chunk layers loaded above & below the camera
+	VerticalRadius int
+	// MinY & MaxY are the lowest & highest chunk layer of the world
+	MinY, MaxY int
+	Shape      LoadShape
+
 	oldPos *ChunkPosition
 	pos    *ChunkPosition
 
 	cam   *Camera
 	world *World
 
+	// all chunk positions requested from the world
+	loaded map[ChunkPosition]bool
+
 	initialized bool
 }
 
+// NewInifinteWorldController creates a controller that loads a single chunk layer at y = 0.
+// Change MinY, MaxY & VerticalRadius to stream chunks vertically.
 func NewInifinteWorldController(cam *Camera, world *World) *InfiniteWorldController {
-	c := &InfiniteWorldController{&ChunkPosition{}, &ChunkPosition{}, cam, world, false}
+	c := &InfiniteWorldController{
+		Radius: 12,
+		oldPos: &ChunkPosition{},
+		pos:    &ChunkPosition{},
+		cam:    cam,
+		world:  world,
+		loaded: make(map[ChunkPosition]bool),
+	}
 
 	return c
 }
 
 func (c *InfiniteWorldController) Update() {
-	chunkX := int(c.cam.position.X) / ChunkWidth
-	chunkY := int(c.cam.position.Y) / ChunkHeight
-	chunkZ := int(c.cam.position.Z) / ChunkDepth
+	chunkX := FloorDiv(int(math.Floor(float64(c.cam.position.X))), ChunkWidth)
+	chunkY := FloorDiv(int(math.Floor(float64(c.cam.position.Y))), ChunkHeight)
+	chunkZ := FloorDiv(int(math.Floor(float64(c.cam.position.Z))), ChunkDepth)
 	c.pos.Set(chunkX, chunkY, chunkZ)
+	c.world.SetFocus(*c.pos, c.cam.direction)
 
-	if !c.initialized {
-		c.init()
+	if !c.initialized || !c.pos.Equals(c.oldPos) {
 		c.initialized = true
-		return
-	}
 
-	if !c.pos.Equals(c.oldPos) {
-		// remove
-		for _, chunk := range c.world.allChunks {
-			if math.Abs(float64(c.pos.X-chunk.Position.X)) > Radius || math.Abs(float64(c.pos.Z-chunk.Position.Z)) > Radius {
-				c.world.RemoveChunk(chunk.Position.X, chunk.Position.Y, chunk.Position.Z)
+		// remove chunks that are out of range
+		for pos := range c.loaded {
+			if !c.inRange(pos) {
+				c.world.RemoveChunk(pos.X, pos.Y, pos.Z)
+				delete(c.loaded, pos)
 			}
 		}
 
-		doGenerate := make(map[ChunkPosition]bool)
-
-		// x direction
-		dx := c.pos.X - c.oldPos.X
-		if dx > 0 {
-			for x := chunkX + Radius - dx; x < chunkX+Radius; x++ {
-				for z := chunkZ - Radius; z < chunkZ+Radius; z++ {
-					doGenerate[ChunkPosition{x, 0, z}] = true
-				}
-			}
-		} else if dx < 0 {
-			for x := chunkX - Radius; x < chunkX-Radius-dx; x++ {
-				for z := chunkZ - Radius; z < chunkZ+Radius; z++ {
-					doGenerate[ChunkPosition{x, 0, z}] = true
-				}
-			}
+		// load chunks that came into range
+		minY, maxY := c.pos.Y-c.VerticalRadius, c.pos.Y+c.VerticalRadius
+		if minY < c.MinY {
+			minY = c.MinY
 		}
-
-		// z direction
-		dz := c.pos.Z - c.oldPos.Z
-		if dz > 0 {
-			for z := chunkZ + Radius; z >= chunkZ+Radius-dz; z-- {
-				for x := chunkX - Radius; x < chunkX+Radius; x++ {
-					doGenerate[ChunkPosition{x, 0, z}] = true
-				}
-			}
-		} else if dz < 0 {
-			for z := chunkZ - Radius - dz; z > chunkZ-Radius; z-- {
-				for x := chunkX - Radius; x < chunkX+Radius; x++ {
-					doGenerate[ChunkPosition{x, 0, z}] = true
+		if maxY > c.MaxY {
+			maxY = c.MaxY
+		}
+		for x := c.pos.X - c.Radius; x <= c.pos.X+c.Radius; x++ {
+			for z := c.pos.Z - c.Radius; z <= c.pos.Z+c.Radius; z++ {
+				for y := minY; y <= maxY; y++ {
+					pos := ChunkPosition{x, y, z}
+					if !c.loaded[pos] && c.inRange(pos) {
+						c.world.GenerateNewChunk(x, y, z)
+						c.loaded[pos] = true
+					}
 				}
 			}
 		}
-
-		for pos := range doGenerate {
-			c.world.GenerateNewChunk(pos.X, pos.Y, pos.Z)
-		}
-
 	}
 
 	c.oldPos.Set(c.pos.X, c.pos.Y, c.pos.Z)
 }
 
-func (c *InfiniteWorldController) init() {
-	for x := -Radius; x < Radius; x++ {
-		for z := -Radius; z < Radius; z++ {
-			c.world.GenerateNewChunk(x, 0, z)
-		}
+// inRange returns true if the chunk should be loaded at the current camera position.
+func (c *InfiniteWorldController) inRange(pos ChunkPosition) bool {
+	if pos.Y < c.MinY || pos.Y > c.MaxY {
+		return false
+	}
+
+	dx := float64(pos.X - c.pos.X)
+	dy := float64(pos.Y - c.pos.Y)
+	dz := float64(pos.Z - c.pos.Z)
+	r := float64(c.Radius)
+	if math.Abs(dy) > float64(c.VerticalRadius) {
+		return false
+	}
+
+	if c.Shape == LoadSphere && c.VerticalRadius > 0 {
+		v := float64(c.VerticalRadius)
+		return (dx*dx+dz*dz)/(r*r)+(dy*dy)/(v*v) <= 1
 	}
+	return dx*dx+dz*dz <= r*r
 }
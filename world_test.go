@@ -0,0 +1,231 @@
+// Copyright (c) 2017 Marcus Brummer.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vox
+
+import (
+	"testing"
+	"time"
+)
+
+func newFlatWorld() *World {
+	bank := newTestBank()
+	return NewWorld(bank, &GreedyMesher{}, NewGeneratorProvider(&FlatGenerator{}, bank))
+}
+
+func newTestWorld() *World {
+	world := newFlatWorld()
+	world.Workers = 0
+	for x := -1; x <= 1; x++ {
+		for y := -1; y <= 1; y++ {
+			for z := -1; z <= 1; z++ {
+				world.GenerateNewChunk(x, y, z)
+			}
+		}
+	}
+	world.processGenerating()
+	world.meshingNeeded.clear()
+	return world
+}
+
+func TestFloorDiv(t *testing.T) {
+	cases := [][3]int{
+		{0, 16, 0}, {15, 16, 0}, {16, 16, 1}, {-1, 16, -1}, {-16, 16, -1}, {-17, 16, -2},
+	}
+	for _, c := range cases {
+		if FloorDiv(c[0], c[1]) != c[2] {
+			t.Errorf("FloorDiv(%v, %v) = %v", c[0], c[1], FloorDiv(c[0], c[1]))
+		}
+	}
+}
+
+func TestWorldGetSetBlock(t *testing.T) {
+	world := newTestWorld()
+
+	block := Block(0).ChangeType(world.bank.Types[2])
+	if !world.SetBlock(-1, -1, 5, block) {
+		t.Fatal()
+	}
+	if world.GetBlock(-1, -1, 5) != block {
+		t.Error()
+	}
+	if world.allChunks[ChunkPosition{-1, -1, 0}].Get(ChunkWidth-1, ChunkHeight-1, 5) != block {
+		t.Error()
+	}
+
+	if !world.SetBlock(-1, -16, 5, block) {
+		t.Fatal()
+	}
+	if world.allChunks[ChunkPosition{-1, -1, 0}].Get(ChunkWidth-1, 0, 5) != block {
+		t.Error()
+	}
+
+	// not loaded
+	if world.SetBlock(-1, -17, 5, block) || world.SetBlock(100, 0, 0, block) || world.GetBlock(100, 0, 0) != BlockNil {
+		t.Error()
+	}
+}
+
+func TestWorldSetBlockMeshing(t *testing.T) {
+	world := newTestWorld()
+	block := Block(0).ChangeType(world.bank.Types[1])
+
+	// inside of a chunk
+	world.SetBlock(5, 5, 5, block)
+	if world.meshingNeeded.len() != 1 || !world.meshingNeeded.contains(ChunkPosition{0, 0, 0}) {
+		t.Error(world.meshingNeeded.len())
+	}
+
+	// on the left border
+	world.meshingNeeded.clear()
+	world.SetBlock(0, 5, 5, block)
+	if world.meshingNeeded.len() != 2 || !world.meshingNeeded.contains(ChunkPosition{-1, 0, 0}) {
+		t.Error(world.meshingNeeded.len())
+	}
+
+	// in the corner of a chunk, all 8 chunks touching the corner
+	world.meshingNeeded.clear()
+	world.SetBlock(-1, -1, -1, block)
+	if world.meshingNeeded.len() != 8 || !world.meshingNeeded.contains(ChunkPosition{0, 0, 0}) {
+		t.Error(world.meshingNeeded.len())
+	}
+}
+
+func TestWorldNeighborMeshing(t *testing.T) {
+	world := newTestWorld()
+
+	world.RemoveChunk(1, 0, 0)
+	if world.meshingNeeded.len() != 17 || !world.meshingNeeded.contains(ChunkPosition{0, 0, 0}) {
+		t.Error(world.meshingNeeded.len())
+	}
+
+	world.meshingNeeded.clear()
+	world.GenerateNewChunk(1, 0, 0)
+	if world.meshingNeeded.len() != 0 {
+		t.Error("chunk should not be generated before the update")
+	}
+	world.processGenerating()
+	if world.meshingNeeded.len() != 18 {
+		t.Error(world.meshingNeeded.len())
+	}
+}
+
+func TestWorldWorkers(t *testing.T) {
+	world := newFlatWorld()
+	world.Workers = 4
+	defer world.Dispose()
+
+	for x := -3; x <= 3; x++ {
+		for z := -3; z <= 3; z++ {
+			world.GenerateNewChunk(x, 0, z)
+		}
+	}
+	world.RemoveChunk(3, 0, 3)
+
+	// edit blocks & remove chunks while the workers are meshing
+	deadline := time.Now().Add(10 * time.Second)
+	for i := 0; ; i++ {
+		world.processGenerating()
+		world.processMeshing()
+		world.SetBlock(i%ChunkWidth, 0, 0, BlockNil)
+		if i == 10 {
+			world.RemoveChunk(-3, 0, -3)
+		}
+
+		idle := world.generatingNeeded.len() == 0 && len(world.generating) == 0 &&
+			world.meshingNeeded.len() == 0 && len(world.meshing) == 0
+		if i > 10 && idle {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("workers did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(world.allChunks) != 47 {
+		t.Error(len(world.allChunks))
+	}
+	for _, item := range world.uploadNeeded.heap {
+		if world.allChunks[item.pos] != item.chunk || item.chunk.meshData == nil {
+			t.Error(item.pos)
+		}
+	}
+	if world.uploadNeeded.contains(ChunkPosition{3, 0, 3}) || world.uploadNeeded.contains(ChunkPosition{-3, 0, -3}) {
+		t.Error()
+	}
+	if world.GetBlock(1, 0, 0) != BlockNil {
+		t.Error()
+	}
+}
+
+func TestInfiniteWorldController(t *testing.T) {
+	world := newFlatWorld()
+	cam := NewCamera(70, 1, 0.01, 1000)
+	controller := NewInifinteWorldController(cam, world)
+	controller.Radius = 2
+	controller.VerticalRadius = 1
+	controller.MinY = -1
+	controller.MaxY = 5
+
+	// 13 chunks within the radius, in 3 layers
+	controller.Update()
+	if world.generatingNeeded.len() != 3*13 {
+		t.Error(world.generatingNeeded.len())
+	}
+	if world.generatingNeeded.contains(ChunkPosition{0, 2, 0}) || !world.generatingNeeded.contains(ChunkPosition{-2, -1, 0}) {
+		t.Error()
+	}
+
+	// move down, the lowest layer is at the world limit
+	cam.Move(-1, -ChunkHeight, 0)
+	controller.Update()
+	if world.generatingNeeded.len() != 2*13 {
+		t.Error(world.generatingNeeded.len())
+	}
+	if world.generatingNeeded.contains(ChunkPosition{1, 1, 0}) || !world.generatingNeeded.contains(ChunkPosition{-3, -1, 0}) {
+		t.Error()
+	}
+
+	// sphere
+	controller.Shape = LoadSphere
+	cam.Move(0, 3*ChunkHeight, 0)
+	controller.Update()
+	if world.generatingNeeded.len() != 13+2 || !world.generatingNeeded.contains(ChunkPosition{-1, 3, 0}) {
+		t.Error(world.generatingNeeded.len())
+	}
+}
+
+func TestWorldReleasesDroppedChunks(t *testing.T) {
+	provider := &fixtureProvider{chunks: map[ChunkPosition]*Chunk{{0, 0, 0}: NewChunk(0, 0, 0)}}
+	world := NewWorld(newTestBank(), &GreedyMesher{}, provider)
+	world.Workers = 1
+	defer world.Dispose()
+
+	// the chunk is removed while the worker generates it
+	world.GenerateNewChunk(0, 0, 0)
+	world.processGenerating()
+	world.RemoveChunk(0, 0, 0)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for provider.released == 0 {
+		world.processGenerating()
+		if time.Now().After(deadline) {
+			t.Fatal("dropped chunk was not released")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if provider.released != 1 || len(world.allChunks) != 0 {
+		t.Error(provider.released, len(world.allChunks))
+	}
+}